@@ -51,6 +51,29 @@ type WrappedObjective interface {
 	ObjectiveAtZero(s sgd.SampleSet) float64
 }
 
+// A Normalizer is a Learner or Objective which can report
+// whether its objectives compute mean costs per sample
+// (weighted by the sample weights) rather than sums.
+//
+// Learners and objectives which wrap others, such as
+// DampingLearner and RegularizedObjective, use this to
+// scale their own terms, so normalization only has to be
+// enabled on the innermost Learner or objective.
+// Anything which is not a Normalizer is assumed to sum
+// over samples.
+type Normalizer interface {
+	Normalized() bool
+}
+
+// isNormalized checks if a Learner or Objective is a
+// Normalizer which reports that it is normalized.
+func isNormalized(x interface{}) bool {
+	if n, ok := x.(Normalizer); ok {
+		return n.Normalized()
+	}
+	return false
+}
+
 // ConcurrentObjective is an Objective which wraps
 // a WrappedObjective and parallelizes calls to that
 // objective while ensuring that no extremely large
@@ -72,19 +95,41 @@ type ConcurrentObjective struct {
 	// can be passed to the wrapped Objective at once.
 	// If this is 0, a reasonable default is used.
 	MaxSubBatch int
+
+	// Normalize specifies that the sums over sub-batches
+	// should be divided by the number of samples (or their
+	// total weight), making the objective a mean over the
+	// samples rather than a sum.
+	// This makes objective values, including those which a
+	// Trainer reports to its UI, comparable across batch
+	// sizes.
+	//
+	// The wrapped objective must not be normalized, since
+	// the results for sub-batches are summed; the methods
+	// panic if it reports that it is.
+	Normalize bool
+}
+
+// Normalized returns c.Normalize.
+func (c *ConcurrentObjective) Normalized() bool {
+	return c.Normalize
 }
 
 func (c *ConcurrentObjective) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
-	return c.sumValues(func(subSet sgd.SampleSet) float64 {
+	return c.normalizer(s) * c.sumValues(func(subSet sgd.SampleSet) float64 {
 		return c.Wrapped.Quad(delta, subSet)
 	}, s)
 }
 
 func (c *ConcurrentObjective) QuadGrad(delta ConstParamDelta,
 	s sgd.SampleSet) ConstParamDelta {
-	return c.sumDeltas(func(subSet sgd.SampleSet) ConstParamDelta {
+	res := c.sumDeltas(func(subSet sgd.SampleSet) ConstParamDelta {
 		return c.Wrapped.QuadGrad(delta, subSet)
 	}, s)
+	if c.Normalize {
+		res.Scale(c.normalizer(s))
+	}
+	return res
 }
 
 func (c *ConcurrentObjective) QuadHessian(delta, x ConstParamDelta,
@@ -98,6 +143,11 @@ func (c *ConcurrentObjective) QuadHessian(delta, x ConstParamDelta,
 		yLock.Unlock()
 		return res
 	}, s)
+	if c.Normalize {
+		scaler := c.normalizer(s)
+		deltaSum.Scale(scaler)
+		y *= scaler
+	}
 	return deltaSum, y
 }
 
@@ -115,9 +165,50 @@ func (c *ConcurrentObjective) Objective(delta ConstParamDelta, s sgd.SampleSet)
 	for variable, backup := range backups {
 		variable.Vector = backup
 	}
+	return c.normalizer(s) * res
+}
+
+// SampleGrads computes the per-sample gradients of the
+// true objective, splitting the samples between
+// goroutines.
+// If the wrapped objective is a SampleGradienter, it is
+// given whole sub-batches; otherwise, QuadGrad is called
+// for each sample.
+func (c *ConcurrentObjective) SampleGrads(params []*autofunc.Variable,
+	s sgd.SampleSet) []ConstParamDelta {
+	c.checkWrapped()
+	subSize := c.MaxSubBatch
+	if subSize == 0 {
+		subSize = defaultMaxSubBatch
+	}
+	res := make([]ConstParamDelta, s.Len())
+	batchCount := (s.Len() + subSize - 1) / subSize
+	parallelFor(batchCount, c.goroutineCount(), func(i int) {
+		start := i * subSize
+		end := start + subSize
+		if end > s.Len() {
+			end = s.Len()
+		}
+		copy(res[start:end], sampleGrads(params, c.Wrapped, s.Subset(start, end)))
+	})
+	if c.Normalize {
+		scaler := c.normalizer(s)
+		for _, grad := range res {
+			grad.Scale(scaler)
+		}
+	}
 	return res
 }
 
+// normalizer returns the factor by which sums over the
+// sample set should be scaled.
+func (c *ConcurrentObjective) normalizer(s sgd.SampleSet) float64 {
+	if !c.Normalize {
+		return 1
+	}
+	return normalizer(s)
+}
+
 func (c *ConcurrentObjective) sumValues(r func(sgd.SampleSet) float64, s sgd.SampleSet) float64 {
 	sampleChan := c.subBatchChan(s)
 
@@ -181,7 +272,16 @@ func (c *ConcurrentObjective) runGoroutines(r func()) *sync.WaitGroup {
 	return wg
 }
 
+// checkWrapped panics if the wrapped objective is
+// normalized.
+func (c *ConcurrentObjective) checkWrapped() {
+	if isNormalized(c.Wrapped) {
+		panic("ConcurrentObjective cannot wrap a normalized objective")
+	}
+}
+
 func (c *ConcurrentObjective) subBatchChan(s sgd.SampleSet) <-chan sgd.SampleSet {
+	c.checkWrapped()
 	subSize := c.MaxSubBatch
 	if subSize == 0 {
 		subSize = defaultMaxSubBatch
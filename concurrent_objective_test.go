@@ -44,6 +44,19 @@ func TestConcurrentObjectiveBasicMultiple(t *testing.T) {
 	testObjectiveEquivalence(t, concurrentObj, obj, delta, samples)
 }
 
+func TestConcurrentObjectiveNormalizedWrapped(t *testing.T) {
+	obj, delta := objectiveTestFunc()
+	obj.Normalize = true
+	concurrentObj := &ConcurrentObjective{Wrapped: obj, Normalize: true}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a normalized wrapped objective")
+		}
+	}()
+	concurrentObj.Quad(delta, objectiveTestSamples(2))
+}
+
 func TestConcurrentObjectiveConcurrentBatches(t *testing.T) {
 	obj, delta := objectiveTestFunc()
 	samples := objectiveTestSamples(11)
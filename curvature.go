@@ -0,0 +1,148 @@
+package hessfree
+
+import (
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// A CurvatureReport describes a dense curvature matrix.
+type CurvatureReport struct {
+	// Layout maps rows and columns of the matrix to entries
+	// of the parameters.
+	Layout *ParamLayout
+
+	// Matrix is the curvature matrix.
+	// Column i is the result of applying QuadHessian to the
+	// i-th basis vector of the layout.
+	Matrix *linalg.Matrix
+
+	// SymmetryError is the largest absolute difference
+	// between mirrored entries of the matrix, divided by
+	// the largest absolute entry.
+	SymmetryError float64
+
+	// Eigenvalues are the eigenvalues of the symmetric part
+	// of the matrix, in ascending order.
+	Eigenvalues linalg.Vector
+
+	MinEigenvalue float64
+	MaxEigenvalue float64
+
+	// ConditionNumber is the ratio between the largest and
+	// smallest absolute eigenvalues.
+	// It is infinite if the matrix is singular.
+	ConditionNumber float64
+}
+
+// PositiveSemidefinite returns true if no eigenvalue is
+// less than -tol times the largest absolute eigenvalue.
+func (c *CurvatureReport) PositiveSemidefinite(tol float64) bool {
+	scale := math.Max(math.Abs(c.MinEigenvalue), math.Abs(c.MaxEigenvalue))
+	return c.MinEigenvalue >= -tol*scale
+}
+
+// DenseCurvature builds the dense curvature matrix of a
+// QuadObjective by applying QuadHessian to every basis
+// vector of the layout.
+//
+// This requires one Hessian-vector product per parameter,
+// so it is only practical for small models.
+//
+// Columns are computed on up to maxConcurrency goroutines,
+// or GOMAXPROCS goroutines if maxConcurrency is 0.
+// Unless maxConcurrency is 1, the objective's methods must
+// be concurrency-safe.
+// A ConcurrentObjective additionally splits each product
+// into sub-batches.
+func DenseCurvature(obj QuadObjective, l *ParamLayout, s sgd.SampleSet,
+	maxConcurrency int) *CurvatureReport {
+	n := l.Len()
+	matrix := linalg.NewMatrix(n, n)
+	zero := l.Unflatten(make(linalg.Vector, n))
+
+	parallelFor(n, maxConcurrency, func(col int) {
+		basis := make(linalg.Vector, n)
+		basis[col] = 1
+		product, _ := obj.QuadHessian(l.Unflatten(basis), zero, s)
+		for row, x := range l.Flatten(product) {
+			matrix.Set(row, col, x)
+		}
+	})
+
+	return newCurvatureReport(l, matrix)
+}
+
+func newCurvatureReport(l *ParamLayout, matrix *linalg.Matrix) *CurvatureReport {
+	n := matrix.Rows
+	res := &CurvatureReport{Layout: l, Matrix: matrix}
+
+	symmetric := linalg.NewMatrix(n, n)
+	var maxEntry, maxDiff float64
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			x, y := matrix.Get(i, j), matrix.Get(j, i)
+			maxEntry = math.Max(maxEntry, math.Abs(x))
+			maxDiff = math.Max(maxDiff, math.Abs(x-y))
+			symmetric.Set(i, j, (x+y)/2)
+		}
+	}
+	if maxEntry != 0 {
+		res.SymmetryError = maxDiff / maxEntry
+	}
+
+	res.Eigenvalues, _ = symmetricEigen(symmetric)
+	if n > 0 {
+		res.MinEigenvalue = res.Eigenvalues[0]
+		res.MaxEigenvalue = res.Eigenvalues[n-1]
+	}
+	res.ConditionNumber = conditionNumber(res.Eigenvalues)
+	return res
+}
+
+// conditionNumber computes the ratio between the largest
+// and smallest absolute eigenvalues.
+func conditionNumber(eigs linalg.Vector) float64 {
+	if len(eigs) == 0 {
+		return math.NaN()
+	}
+	minAbs := math.Inf(1)
+	var maxAbs float64
+	for _, x := range eigs {
+		minAbs = math.Min(minAbs, math.Abs(x))
+		maxAbs = math.Max(maxAbs, math.Abs(x))
+	}
+	if minAbs == 0 {
+		return math.Inf(1)
+	}
+	return maxAbs / minAbs
+}
+
+// parallelFor calls f for every index in [0, n) on up to
+// maxConcurrency goroutines, or GOMAXPROCS goroutines if
+// maxConcurrency is 0.
+func parallelFor(n, maxConcurrency int, f func(i int)) {
+	if maxConcurrency == 0 {
+		maxConcurrency = runtime.GOMAXPROCS(0)
+	}
+	indices := make(chan int, n)
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				f(idx)
+			}
+		}()
+	}
+	wg.Wait()
+}
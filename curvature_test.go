@@ -0,0 +1,265 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+const curvatureTestPrec = 1e-6
+
+func TestSymmetricEigen(t *testing.T) {
+	n := 6
+	matrix := linalg.NewMatrix(n, n)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			x := rand.NormFloat64()
+			matrix.Set(i, j, x)
+			matrix.Set(j, i, x)
+		}
+	}
+	values, vectors := symmetricEigen(matrix)
+	for k := 0; k < n; k++ {
+		if k > 0 && values[k] < values[k-1] {
+			t.Error("eigenvalues are not sorted")
+		}
+		for i := 0; i < n; i++ {
+			var product float64
+			for j := 0; j < n; j++ {
+				product += matrix.Get(i, j) * vectors.Get(j, k)
+			}
+			expected := values[k] * vectors.Get(i, k)
+			if math.Abs(product-expected) > curvatureTestPrec {
+				t.Errorf("eigenvector %d: entry %d should be %f but got %f", k, i,
+					expected, product)
+			}
+		}
+	}
+}
+
+func TestDenseCurvature(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  3,
+			OutputCount: 2,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  2,
+			OutputCount: 3,
+		},
+	}
+	network.Randomize()
+	learner := &NeuralNetLearner{
+		Layers:      network,
+		Cost:        neuralnet.SigmoidCECost{},
+		MaxSubBatch: 3,
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 10; i++ {
+		vec := make(linalg.Vector, 3)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	samples := neuralnet.VectorSampleSet(inputs, inputs)
+
+	layout := NewParamLayout(learner.Parameters())
+	objective := learner.MakeObjective()
+	report := DenseCurvature(objective, layout, samples, 0)
+
+	if report.SymmetryError > curvatureTestPrec {
+		t.Error("unexpected symmetry error", report.SymmetryError)
+	}
+	if !report.PositiveSemidefinite(curvatureTestPrec) {
+		t.Error("Gauss-Newton matrix should be PSD, but min eigenvalue is",
+			report.MinEigenvalue)
+	}
+	if report.ConditionNumber < 1 {
+		t.Error("invalid condition number", report.ConditionNumber)
+	}
+
+	vec := make(linalg.Vector, layout.Len())
+	for i := range vec {
+		vec[i] = rand.NormFloat64()
+	}
+	expected, _ := objective.QuadHessian(layout.Unflatten(vec),
+		layout.Unflatten(make(linalg.Vector, layout.Len())), samples)
+	expectedVec := layout.Flatten(expected)
+	for i, x := range expectedVec {
+		var a float64
+		for j, y := range vec {
+			a += report.Matrix.Get(i, j) * y
+		}
+		if math.Abs(a-x) > curvatureTestPrec {
+			t.Errorf("product entry %d should be %f but got %f", i, x, a)
+		}
+	}
+}
+
+func TestLanczos(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  3,
+			OutputCount: 2,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  2,
+			OutputCount: 3,
+		},
+	}
+	network.Randomize()
+	learner := &DampingLearner{
+		WrappedLearner: &NeuralNetLearner{
+			Layers:      network,
+			Cost:        neuralnet.SigmoidCECost{},
+			MaxSubBatch: 3,
+		},
+		DampingCoeff: 0.1,
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 10; i++ {
+		vec := make(linalg.Vector, 3)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	samples := neuralnet.VectorSampleSet(inputs, inputs)
+
+	layout := NewParamLayout(learner.Parameters())
+	objective := learner.MakeObjective()
+	report := DenseCurvature(objective, layout, samples, 1)
+	result := Lanczos(objective, layout, samples, nil, layout.Len())
+
+	if math.Abs(result.MaxEigenvalue()-report.MaxEigenvalue) > curvatureTestPrec {
+		t.Error("max eigenvalue should be", report.MaxEigenvalue, "but got",
+			result.MaxEigenvalue())
+	}
+	if math.Abs(result.MinEigenvalue()-report.MinEigenvalue) > curvatureTestPrec {
+		t.Error("min eigenvalue should be", report.MinEigenvalue, "but got",
+			result.MinEigenvalue())
+	}
+
+	for i, basisVec := range result.Basis {
+		for j := 0; j <= i; j++ {
+			expected := 0.0
+			if i == j {
+				expected = 1
+			}
+			if dot := basisVec.Dot(result.Basis[j]); math.Abs(dot-expected) > curvatureTestPrec {
+				t.Errorf("basis vectors %d and %d have dot product %f", i, j, dot)
+			}
+		}
+	}
+
+	zero := layout.Unflatten(make(linalg.Vector, layout.Len()))
+	for _, idx := range []int{0, len(result.RitzValues) - 1} {
+		vec := result.RitzVectors[idx]
+		product, _ := objective.QuadHessian(vec, zero, samples)
+		product.Axpy(-result.RitzValues[idx], vec)
+		if product.Norm() > 1e-4 {
+			t.Errorf("Ritz vector %d has residual %f", idx, product.Norm())
+		}
+	}
+}
+
+func TestLanczosEmpty(t *testing.T) {
+	param := &autofunc.Variable{Vector: make(linalg.Vector, 2)}
+	objective := &saddleTestObjective{
+		Param:     param,
+		Curvature: linalg.Vector{1, 2},
+		Gradient:  make(linalg.Vector, 2),
+	}
+	samples := WeightedSampleSet([]linalg.Vector{{0}}, []linalg.Vector{{0}}, []float64{1})
+
+	zeroStart := ConstParamDelta{param: make(linalg.Vector, 2)}
+	results := []*LanczosResult{
+		Lanczos(objective, NewParamLayout([]*autofunc.Variable{param}), samples,
+			zeroStart, 0),
+		Lanczos(objective, NewParamLayout(nil), samples, nil, 0),
+	}
+	for i, result := range results {
+		if len(result.RitzValues) != 0 {
+			t.Errorf("result %d: expected no Ritz values but got %v", i, result.RitzValues)
+		}
+		if !math.IsNaN(result.MinEigenvalue()) || !math.IsNaN(result.MaxEigenvalue()) ||
+			!math.IsNaN(result.ConditionNumber()) {
+			t.Errorf("result %d: expected NaN estimates", i)
+		}
+	}
+}
+
+func TestHutchinsonEstimator(t *testing.T) {
+	rand.Seed(1337)
+
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  3,
+			OutputCount: 2,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  2,
+			OutputCount: 3,
+		},
+	}
+	network.Randomize()
+	learner := &NeuralNetLearner{
+		Layers:      network,
+		Cost:        neuralnet.SigmoidCECost{},
+		MaxSubBatch: 3,
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 10; i++ {
+		vec := make(linalg.Vector, 3)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	samples := neuralnet.VectorSampleSet(inputs, inputs)
+
+	params := learner.Parameters()
+	layout := NewParamLayout(params)
+	objective := learner.MakeObjective()
+	report := DenseCurvature(objective, layout, samples, 0)
+
+	estimator := &HutchinsonEstimator{
+		Objective: objective,
+		Probes:    200,
+	}
+
+	var expectedTrace float64
+	for i := 0; i < layout.Len(); i++ {
+		expectedTrace += report.Matrix.Get(i, i)
+	}
+	trace, traceErr := estimator.Trace(params, samples)
+	if math.Abs(trace-expectedTrace) > 5*traceErr {
+		t.Error("trace should be", expectedTrace, "but got", trace, "+/-", traceErr)
+	}
+
+	diag, diagErr := estimator.Diagonal(params, samples)
+	flatDiag := layout.Flatten(diag)
+	flatErr := layout.Flatten(diagErr)
+	var outliers int
+	for i, x := range flatDiag {
+		expected := report.Matrix.Get(i, i)
+		if math.Abs(x-expected) > 4*flatErr[i]+curvatureTestPrec {
+			outliers++
+		}
+	}
+	if outliers > layout.Len()/10 {
+		t.Errorf("%d of %d diagonal entries are outside of their error bars", outliers,
+			layout.Len())
+	}
+}
@@ -0,0 +1,253 @@
+package hessfree
+
+import (
+	"math/rand"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+const (
+	defaultGaussNewtonProbes = 5
+	defaultMagnitudeDecay    = 0.9
+)
+
+// A DampingDiagonal produces a diagonal matrix D which
+// replaces the identity in the damping penalty, so that
+// the penalty becomes lambda*(delta^T D delta).
+//
+// The entries of D should be non-negative and expressed
+// per sample, since the damping penalty is already scaled
+// by the number of samples (or their total weight).
+type DampingDiagonal interface {
+	// Diagonal computes the diagonal entries of D for the
+	// given parameters.
+	// The objective is the undamped objective created for
+	// the current mini-batch, and s is the mini-batch.
+	Diagonal(params []*autofunc.Variable, obj Objective, s sgd.SampleSet) ConstParamDelta
+}
+
+// GaussNewtonDiagonal estimates the diagonal of an
+// objective's curvature matrix using random probes, as
+// described in Bekas et al. (2007).
+// For Gauss-Newton objectives, this approximates the
+// diagonal of the Gauss-Newton matrix.
+type GaussNewtonDiagonal struct {
+	// Probes is the number of curvature-vector products
+	// used for the estimate.
+	// If this is 0, a reasonable default is used.
+	Probes int
+}
+
+// Diagonal estimates the curvature diagonal, clipping
+// negative estimates to zero.
+func (g *GaussNewtonDiagonal) Diagonal(params []*autofunc.Variable, obj Objective,
+	s sgd.SampleSet) ConstParamDelta {
+	probes := g.Probes
+	if probes == 0 {
+		probes = defaultGaussNewtonProbes
+	}
+
+	estimator := &HutchinsonEstimator{
+		Objective:      obj,
+		Probes:         probes,
+		MaxConcurrency: 1,
+	}
+	res, _ := estimator.Diagonal(params, s)
+
+	scaler := 1 / totalWeight(s)
+	for _, resVec := range res {
+		for i, x := range resVec {
+			if x < 0 {
+				resVec[i] = 0
+			} else {
+				resVec[i] = x * scaler
+			}
+		}
+	}
+	return res
+}
+
+// A SampleGradienter is an Objective which can compute
+// the gradient of its true objective for every sample in
+// a set with a single call.
+type SampleGradienter interface {
+	// SampleGrads computes the gradient of the true
+	// objective with respect to the given parameters for
+	// each sample in s, at a delta of zero.
+	// The gradients include the sample weights, so that
+	// they sum to the gradient for the whole set.
+	SampleGrads(params []*autofunc.Variable, s sgd.SampleSet) []ConstParamDelta
+}
+
+// FisherDiagonal computes the diagonal of the empirical
+// Fisher matrix, i.e. the mean squared per-sample gradient.
+// For WeightedSamples, this is a weighted mean of the
+// squared unweighted gradients.
+//
+// If the objective is a SampleGradienter, the per-sample
+// gradients are computed with one call to SampleGrads.
+// Otherwise, QuadGrad is called for each sample.
+type FisherDiagonal struct {
+	// MaxSamples is the maximum number of samples from each
+	// mini-batch to use for the estimate.
+	// The samples are chosen at random.
+	// If this is 0, every sample is used.
+	MaxSamples int
+}
+
+// Diagonal computes the empirical Fisher diagonal using
+// the gradients of obj at a delta of zero.
+func (f *FisherDiagonal) Diagonal(params []*autofunc.Variable, obj Objective,
+	s sgd.SampleSet) ConstParamDelta {
+	if f.MaxSamples != 0 && f.MaxSamples < s.Len() {
+		subset := make(sgd.SliceSampleSet, f.MaxSamples)
+		for i, j := range rand.Perm(s.Len())[:f.MaxSamples] {
+			subset[i] = s.GetSample(j)
+		}
+		s = subset
+	}
+
+	res := ConstParamDelta{}
+	for _, param := range params {
+		res[param] = make(linalg.Vector, len(param.Vector))
+	}
+
+	var weightSum float64
+	grads := sampleGrads(params, obj, s)
+	for i, grad := range grads {
+		weight := sampleWeight(s.GetSample(i))
+		if weight == 0 {
+			continue
+		}
+		weightSum += weight
+		for param, resVec := range res {
+			for j, x := range grad[param] {
+				// The gradient is already scaled by the weight.
+				resVec[j] += x * x / weight
+			}
+		}
+	}
+
+	if weightSum != 0 {
+		for _, resVec := range res {
+			resVec.Scale(1 / weightSum)
+		}
+	}
+	return res
+}
+
+// sampleGrads computes the gradient of obj at a delta of
+// zero for each sample in s.
+// Gradients for samples with zero weight may be nil.
+func sampleGrads(params []*autofunc.Variable, obj QuadObjective,
+	s sgd.SampleSet) []ConstParamDelta {
+	if sg, ok := obj.(SampleGradienter); ok {
+		return sg.SampleGrads(params, s)
+	}
+	return quadGradSamples(params, obj, s)
+}
+
+// quadGradSamples is like sampleGrads, but it always calls
+// QuadGrad once per sample.
+func quadGradSamples(params []*autofunc.Variable, obj QuadObjective,
+	s sgd.SampleSet) []ConstParamDelta {
+	zero := ConstParamDelta{}
+	for _, param := range params {
+		zero[param] = make(linalg.Vector, len(param.Vector))
+	}
+	res := make([]ConstParamDelta, s.Len())
+	for i := range res {
+		if sampleWeight(s.GetSample(i)) != 0 {
+			res[i] = obj.QuadGrad(zero, s.Subset(i, i+1))
+		}
+	}
+	return res
+}
+
+// MagnitudeDiagonal uses a running average of the squared
+// parameter values as the damping diagonal, so that each
+// parameter is damped relative to its own scale.
+type MagnitudeDiagonal struct {
+	// Decay is the rate at which old squared values are
+	// forgotten, between 0 and 1.
+	// If this is 0, a reasonable default is used.
+	Decay float64
+
+	averages ConstParamDelta
+}
+
+// Diagonal updates the running averages with the current
+// parameter values and returns a copy of the averages.
+func (m *MagnitudeDiagonal) Diagonal(params []*autofunc.Variable, obj Objective,
+	s sgd.SampleSet) ConstParamDelta {
+	decay := m.Decay
+	if decay == 0 {
+		decay = defaultMagnitudeDecay
+	}
+	if m.averages == nil {
+		m.averages = ConstParamDelta{}
+	}
+
+	res := ConstParamDelta{}
+	for _, param := range params {
+		avg, ok := m.averages[param]
+		if !ok {
+			avg = make(linalg.Vector, len(param.Vector))
+			for i, x := range param.Vector {
+				avg[i] = x * x
+			}
+			m.averages[param] = avg
+		} else {
+			for i, x := range param.Vector {
+				avg[i] = decay*avg[i] + (1-decay)*x*x
+			}
+		}
+		res[param] = avg.Copy()
+	}
+	return res
+}
+
+// rademacherDelta creates a delta whose entries are
+// randomly chosen from {-1, 1}.
+func rademacherDelta(params []*autofunc.Variable) ConstParamDelta {
+	res := ConstParamDelta{}
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			if rand.Intn(2) == 0 {
+				vec[i] = -1
+			} else {
+				vec[i] = 1
+			}
+		}
+		res[param] = vec
+	}
+	return res
+}
+
+// clampDiagonal raises every entry of a diagonal to at
+// least minScale times the mean entry, preventing the
+// damping from vanishing in any direction.
+func clampDiagonal(diag ConstParamDelta, minScale float64) {
+	var sum float64
+	var count int
+	for _, vec := range diag {
+		for _, x := range vec {
+			sum += x
+		}
+		count += len(vec)
+	}
+	if count == 0 {
+		return
+	}
+	minValue := minScale * sum / float64(count)
+	for _, vec := range diag {
+		for i, x := range vec {
+			if x < minValue {
+				vec[i] = minValue
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package hessfree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+const dampingDiagTestPrec = 1e-8
+
+func TestGaussNewtonDiagonalValues(t *testing.T) {
+	param := &autofunc.Variable{Vector: make(linalg.Vector, 3)}
+	obj := &saddleTestObjective{
+		Param:     param,
+		Curvature: linalg.Vector{2, 3, -1},
+		Gradient:  make(linalg.Vector, 3),
+	}
+	samples := WeightedSampleSet([]linalg.Vector{{0}, {0}}, []linalg.Vector{{0}, {0}},
+		[]float64{1, 3})
+
+	// Rademacher probes are exact for diagonal matrices.
+	diag := (&GaussNewtonDiagonal{}).Diagonal([]*autofunc.Variable{param}, obj, samples)
+	testDiagonalValues(t, diag[param], linalg.Vector{0.5, 0.75, 0})
+}
+
+func TestFisherDiagonalValues(t *testing.T) {
+	param := &autofunc.Variable{Vector: make(linalg.Vector, 2)}
+	obj := &linearTestObjective{Param: param}
+	samples := WeightedSampleSet([]linalg.Vector{{1, 2}, {3, -1}, {5, 5}},
+		[]linalg.Vector{{0}, {0}, {0}}, []float64{1, 2, 0})
+
+	diag := (&FisherDiagonal{}).Diagonal([]*autofunc.Variable{param}, obj, samples)
+	testDiagonalValues(t, diag[param], linalg.Vector{19.0 / 3, 2})
+
+	// With one random sample, the diagonal is that
+	// sample's squared gradient.
+	seen := map[float64]bool{}
+	for i := 0; i < 20; i++ {
+		diag = (&FisherDiagonal{MaxSamples: 1}).Diagonal([]*autofunc.Variable{param}, obj,
+			samples.Subset(0, 2))
+		if diag[param][0] == 1 {
+			testDiagonalValues(t, diag[param], linalg.Vector{1, 4})
+		} else {
+			testDiagonalValues(t, diag[param], linalg.Vector{9, 1})
+		}
+		seen[diag[param][0]] = true
+	}
+	if len(seen) != 2 {
+		t.Error("expected both samples to be chosen")
+	}
+}
+
+func TestFisherDiagonalSampleGrads(t *testing.T) {
+	learner, samples := trainerTestLearner()
+	params := learner.Parameters()
+	obj := learner.WrappedLearner.MakeObjective()
+
+	grads := obj.(SampleGradienter).SampleGrads(params, samples)
+	sum := grads[0].Clone()
+	for _, grad := range grads[1:] {
+		sum.Axpy(1, grad)
+	}
+	zero := ConstParamDelta{}
+	for _, param := range params {
+		zero[param] = make(linalg.Vector, len(param.Vector))
+	}
+	expected := obj.QuadGrad(zero, samples)
+	for _, param := range params {
+		testDiagonalValues(t, sum[param], expected[param])
+	}
+
+	fisher := &FisherDiagonal{}
+	actual := fisher.Diagonal(params, obj, samples)
+	perSample := fisher.Diagonal(params, &quadGradOnlyObjective{obj}, samples)
+	for _, param := range params {
+		testDiagonalValues(t, actual[param], perSample[param])
+	}
+}
+
+func TestFisherDiagonalNormalized(t *testing.T) {
+	learner, samples := trainerTestLearner()
+	network := learner.WrappedLearner.(*NeuralNetLearner).Layers
+	params := network.Parameters()
+	weights := make([]float64, samples.Len())
+	var inputs, outputs []linalg.Vector
+	for i := range weights {
+		weights[i] = float64(i%3) + 0.5
+		sample := vectorSample(samples.GetSample(i))
+		inputs = append(inputs, sample.Input)
+		outputs = append(outputs, sample.Output)
+	}
+	weighted := WeightedSampleSet(inputs, outputs, weights)
+
+	var diags []ConstParamDelta
+	for _, normalize := range []bool{false, true} {
+		reg := &RegularizedLearner{
+			WrappedLearner: &NeuralNetLearner{
+				Layers:    network,
+				Cost:      neuralnet.SigmoidCECost{},
+				Normalize: normalize,
+			},
+			Regularizer: &L2Regularizer{Coeff: 0.1},
+		}
+		obj := reg.MakeObjective()
+		if normalize {
+			obj = &summedObjective{obj}
+		}
+		diags = append(diags, (&FisherDiagonal{}).Diagonal(params, obj, weighted))
+	}
+	for _, param := range params {
+		testDiagonalValues(t, diags[1][param], diags[0][param])
+	}
+}
+
+func TestMagnitudeDiagonalValues(t *testing.T) {
+	param := &autofunc.Variable{Vector: linalg.Vector{1, -2}}
+	params := []*autofunc.Variable{param}
+	m := &MagnitudeDiagonal{Decay: 0.5}
+
+	testDiagonalValues(t, m.Diagonal(params, nil, nil)[param], linalg.Vector{1, 4})
+	param.Vector = linalg.Vector{3, 0}
+	testDiagonalValues(t, m.Diagonal(params, nil, nil)[param], linalg.Vector{5, 2})
+}
+
+func TestDampedObjectiveDiagonalPerSet(t *testing.T) {
+	param := &autofunc.Variable{Vector: make(linalg.Vector, 2)}
+	calls := map[int]int{}
+	obj := &dampedObjective{
+		WrappedObjective: &saddleTestObjective{
+			Param:     param,
+			Curvature: make(linalg.Vector, 2),
+			Gradient:  make(linalg.Vector, 2),
+		},
+		Coeff: 0.5,
+		DiagonalFunc: func(s sgd.SampleSet) ConstParamDelta {
+			calls[s.Len()]++
+			n := float64(s.Len())
+			return ConstParamDelta{param: linalg.Vector{n, 2 * n}}
+		},
+	}
+	samples := WeightedSampleSet([]linalg.Vector{{0}, {0}, {0}},
+		[]linalg.Vector{{0}, {0}, {0}}, []float64{1, 1, 1})
+	delta := ConstParamDelta{param: linalg.Vector{1, 2}}
+
+	for i := 0; i < 2; i++ {
+		// Two samples: 0.5 * 2 * (2*1 + 4*4).
+		if val := obj.Quad(delta, samples.Subset(0, 2)); math.Abs(val-18) > dampingDiagTestPrec {
+			t.Error("expected 18 but got", val)
+		}
+		// Three samples: 0.5 * 3 * (3*1 + 6*4).
+		if val := obj.Quad(delta, samples); math.Abs(val-40.5) > dampingDiagTestPrec {
+			t.Error("expected 40.5 but got", val)
+		}
+	}
+	if calls[2] != 1 || calls[3] != 1 {
+		t.Error("expected one diagonal per set but got", calls)
+	}
+}
+
+func testDiagonalValues(t *testing.T, actual, expected linalg.Vector) {
+	if len(actual) != len(expected) {
+		t.Errorf("expected length %d but got %d", len(expected), len(actual))
+		return
+	}
+	for i, x := range expected {
+		if math.Abs(actual[i]-x) > dampingDiagTestPrec {
+			t.Errorf("entry %d: expected %f but got %f", i, x, actual[i])
+		}
+	}
+}
+
+// linearTestObjective is the sum over samples of the
+// weighted dot product between the sample's input and
+// the parameter.
+type linearTestObjective struct {
+	Param *autofunc.Variable
+}
+
+func (l *linearTestObjective) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	return l.Objective(delta, s)
+}
+
+func (l *linearTestObjective) QuadGrad(delta ConstParamDelta, s sgd.SampleSet) ConstParamDelta {
+	res := make(linalg.Vector, len(l.Param.Vector))
+	for i := 0; i < s.Len(); i++ {
+		weight := sampleWeight(s.GetSample(i))
+		res.Add(vectorSample(s.GetSample(i)).Input.Copy().Scale(weight))
+	}
+	return ConstParamDelta{l.Param: res}
+}
+
+func (l *linearTestObjective) QuadHessian(delta, x ConstParamDelta,
+	s sgd.SampleSet) (ConstParamDelta, float64) {
+	return ConstParamDelta{l.Param: make(linalg.Vector, len(l.Param.Vector))},
+		l.Quad(x, s)
+}
+
+func (l *linearTestObjective) Objective(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	point := l.Param.Vector.Copy()
+	if d, ok := delta[l.Param]; ok {
+		point.Add(d)
+	}
+	return l.QuadGrad(nil, s)[l.Param].Dot(point)
+}
+
+// quadGradOnlyObjective hides the SampleGrads method of
+// an objective.
+type quadGradOnlyObjective struct {
+	Wrapped Objective
+}
+
+func (q *quadGradOnlyObjective) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	return q.Wrapped.Quad(delta, s)
+}
+
+func (q *quadGradOnlyObjective) QuadGrad(delta ConstParamDelta,
+	s sgd.SampleSet) ConstParamDelta {
+	return q.Wrapped.QuadGrad(delta, s)
+}
+
+func (q *quadGradOnlyObjective) QuadHessian(delta, x ConstParamDelta,
+	s sgd.SampleSet) (ConstParamDelta, float64) {
+	return q.Wrapped.QuadHessian(delta, x, s)
+}
+
+func (q *quadGradOnlyObjective) Objective(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	return q.Wrapped.Objective(delta, s)
+}
@@ -0,0 +1,421 @@
+package hessfree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDashboardHistory = 200
+	dashboardLogCount       = 20
+	dashboardPlotWidth      = 500
+	dashboardPlotHeight     = 120
+)
+
+// DashboardUI is a UI which serves a status page over
+// HTTP, showing training progress with plots of recent
+// values.
+// The page has a stop button which makes ShouldStop
+// return true.
+//
+// To keep other web pages from stopping training, stop
+// requests are rejected unless their Host (and Origin, if
+// present) is the listening address, "localhost", or an
+// IP address, on the listening port.
+// Other host names are rejected to prevent DNS rebinding.
+type DashboardUI struct {
+	server   *http.Server
+	listener net.Listener
+
+	lock         sync.Mutex
+	epoch        int
+	batch        int
+	cgIterations int
+	objectives   *ringBuffer
+	quadValues   *ringBuffer
+	dampings     *ringBuffer
+	iterCounts   *ringBuffer
+	backtracks   *ringBuffer
+	ratios       *ringBuffer
+	timings      map[string]*ringBuffer
+	history      int
+	logs         []string
+
+	killFlag uint32
+}
+
+// NewDashboardUI creates a DashboardUI which listens on
+// the given address (e.g. "localhost:8080").
+// The history argument specifies how many values to keep
+// for each plot; if it is 0, a reasonable default is used.
+// A negative history is an error.
+func NewDashboardUI(addr string, history int) (*DashboardUI, error) {
+	if history < 0 {
+		return nil, fmt.Errorf("invalid dashboard history: %d", history)
+	}
+	if history == 0 {
+		history = defaultDashboardHistory
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	res := &DashboardUI{
+		listener:   listener,
+		objectives: newRingBuffer(history),
+		quadValues: newRingBuffer(history),
+		dampings:   newRingBuffer(history),
+		iterCounts: newRingBuffer(history),
+		backtracks: newRingBuffer(history),
+		ratios:     newRingBuffer(history),
+		timings:    map[string]*ringBuffer{},
+		history:    history,
+	}
+	res.server = &http.Server{Handler: res}
+	go res.server.Serve(listener)
+	return res, nil
+}
+
+// Addr returns the address on which the dashboard is
+// listening.
+func (d *DashboardUI) Addr() net.Addr {
+	return d.listener.Addr()
+}
+
+// Close stops the HTTP server.
+func (d *DashboardUI) Close() error {
+	return d.server.Close()
+}
+
+// ServeHTTP serves the status page on "/", a JSON version
+// of the status on "/status", and stops training when a
+// POST request is sent to "/stop".
+func (d *DashboardUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		d.servePage(w)
+	case "/status":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.status())
+	case "/stop":
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !d.sameOrigin(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		atomic.StoreUint32(&d.killFlag, 1)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *DashboardUI) LogCGStart(initQuad, quadLast float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.cgIterations = 0
+	d.quadValues.Add(initQuad)
+}
+
+func (d *DashboardUI) LogCGIteration(stepSize, quadValue float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.cgIterations++
+	d.quadValues.Add(quadValue)
+}
+
+func (d *DashboardUI) LogNewMiniBatch(epochNum, batchNum int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.epoch = epochNum
+	d.batch = batchNum
+}
+
+func (d *DashboardUI) Log(sender, message string) {
+	d.addLog(fmt.Sprintf("%s: %s", sender, message))
+}
+
+func (d *DashboardUI) ShouldStop() bool {
+	return atomic.LoadUint32(&d.killFlag) != 0
+}
+
+func (d *DashboardUI) LogDamping(trust, coeff float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.dampings.Add(coeff)
+}
+
+func (d *DashboardUI) LogBacktrack(iteration int, objective float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.backtracks.Add(objective)
+}
+
+func (d *DashboardUI) LogUpdate(iterations int, objective float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.iterCounts.Add(float64(iterations))
+	d.objectives.Add(objective)
+}
+
+func (d *DashboardUI) LogReductionRatio(ratio float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.ratios.Add(ratio)
+}
+
+func (d *DashboardUI) LogEpochEnd(epoch int) {
+	d.addLog(fmt.Sprintf("finished epoch %d", epoch))
+}
+
+func (d *DashboardUI) LogValidation(epoch int, cost float64) {
+	d.addLog(fmt.Sprintf("validation cost after epoch %d: %f", epoch, cost))
+}
+
+// LogTiming records the duration in milliseconds, with a
+// separate plot for each name.
+func (d *DashboardUI) LogTiming(name string, duration time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	buf, ok := d.timings[name]
+	if !ok {
+		buf = newRingBuffer(d.history)
+		d.timings[name] = buf
+	}
+	buf.Add(duration.Seconds() * 1000)
+}
+
+func (d *DashboardUI) addLog(message string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	message = time.Now().Format("15:04:05") + " " + message
+	d.logs = append(d.logs, message)
+	if len(d.logs) > dashboardLogCount {
+		d.logs = d.logs[1:]
+	}
+}
+
+// sameOrigin checks that a request was made to the
+// dashboard's own address, from a page on that address.
+func (d *DashboardUI) sameOrigin(r *http.Request) bool {
+	if !d.allowedHost(r.Host) {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// allowedHost checks if a "host:port" string refers to
+// the dashboard's listener.
+func (d *DashboardUI) allowedHost(hostPort string) bool {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return false
+	}
+	listenHost, listenPort, err := net.SplitHostPort(d.listener.Addr().String())
+	if err != nil || port != listenPort {
+		return false
+	}
+	return host == listenHost || host == "localhost" || net.ParseIP(host) != nil
+}
+
+type dashboardStatus struct {
+	Epoch           int                  `json:"epoch"`
+	Batch           int                  `json:"batch"`
+	CGIterations    int                  `json:"cg_iterations"`
+	Objectives      []float64            `json:"objectives"`
+	QuadValues      []float64            `json:"quad_values"`
+	Dampings        []float64            `json:"dampings"`
+	IterCounts      []float64            `json:"iteration_counts"`
+	Backtracks      []float64            `json:"backtracks"`
+	ReductionRatios []float64            `json:"reduction_ratios"`
+	Timings         map[string][]float64 `json:"timings_ms"`
+	Logs            []string             `json:"logs"`
+	Stopped         bool                 `json:"stopped"`
+}
+
+func (d *DashboardUI) status() *dashboardStatus {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	timings := map[string][]float64{}
+	for name, buf := range d.timings {
+		timings[name] = buf.Values()
+	}
+	return &dashboardStatus{
+		Epoch:           d.epoch,
+		Batch:           d.batch,
+		CGIterations:    d.cgIterations,
+		Objectives:      finiteValues(d.objectives.Values()),
+		QuadValues:      finiteValues(d.quadValues.Values()),
+		Dampings:        finiteValues(d.dampings.Values()),
+		IterCounts:      d.iterCounts.Values(),
+		Backtracks:      finiteValues(d.backtracks.Values()),
+		ReductionRatios: finiteValues(d.ratios.Values()),
+		Timings:         timings,
+		Logs:            append([]string{}, d.logs...),
+		Stopped:         d.ShouldStop(),
+	}
+}
+
+func (d *DashboardUI) servePage(w http.ResponseWriter) {
+	status := d.status()
+	type plot struct {
+		Title string
+		SVG   template.HTML
+	}
+	plots := []plot{
+		{"Objective after update", svgPlot(status.Objectives)},
+		{"Quadratic values", svgPlot(status.QuadValues)},
+		{"Damping coefficient", svgPlot(status.Dampings)},
+		{"Reduction ratio", svgPlot(status.ReductionRatios)},
+		{"CG iterations per mini-batch", svgPlot(status.IterCounts)},
+		{"Objective at backtracking checkpoints", svgPlot(status.Backtracks)},
+	}
+	var timingNames []string
+	for name := range status.Timings {
+		timingNames = append(timingNames, name)
+	}
+	sort.Strings(timingNames)
+	for _, name := range timingNames {
+		plots = append(plots, plot{
+			Title: fmt.Sprintf("Timing for %s (ms)", name),
+			SVG:   svgPlot(status.Timings[name]),
+		})
+	}
+	var buf bytes.Buffer
+	err := dashboardTemplate.Execute(&buf, map[string]interface{}{
+		"Status": status,
+		"Plots":  plots,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// svgPlot renders a line plot of the values.
+func svgPlot(values []float64) template.HTML {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg width="%d" height="%d" class="plot">`, dashboardPlotWidth,
+		dashboardPlotHeight)
+	if len(values) > 0 {
+		min, max := values[0], values[0]
+		for _, x := range values {
+			min = math.Min(min, x)
+			max = math.Max(max, x)
+		}
+		if max == min {
+			max, min = max+1, min-1
+		}
+		buf.WriteString(`<polyline fill="none" stroke="steelblue" points="`)
+		for i, x := range values {
+			var xPos float64
+			if len(values) > 1 {
+				xPos = float64(i) / float64(len(values)-1) * dashboardPlotWidth
+			}
+			yPos := (max - x) / (max - min) * dashboardPlotHeight
+			fmt.Fprintf(&buf, "%.2f,%.2f ", xPos, yPos)
+		}
+		buf.WriteString(`"/>`)
+		fmt.Fprintf(&buf, `<text x="2" y="12">%g</text>`, max)
+		fmt.Fprintf(&buf, `<text x="2" y="%d">%g</text>`, dashboardPlotHeight-2, min)
+	}
+	buf.WriteString(`</svg>`)
+	return template.HTML(buf.String())
+}
+
+func finiteValues(values []float64) []float64 {
+	res := make([]float64, 0, len(values))
+	for _, x := range values {
+		if !math.IsNaN(x) && !math.IsInf(x, 0) {
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>Hessian Free</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+.plot { border: 1px solid #ccc; display: block; margin-bottom: 15px; }
+.plot text { font-size: 10px; fill: #666; }
+</style>
+</head>
+<body>
+<h1>Hessian Free</h1>
+<p>Epoch {{.Status.Epoch}}, mini-batch {{.Status.Batch}},
+{{.Status.CGIterations}} CG iterations so far.</p>
+{{if .Status.Stopped}}
+<p><strong>Stopping after the current step.</strong></p>
+{{else}}
+<form method="POST" action="/stop"><button type="submit">Stop training</button></form>
+{{end}}
+{{range .Plots}}
+<h3>{{.Title}}</h3>
+{{.SVG}}
+{{end}}
+<h3>Log</h3>
+<pre>{{range .Status.Logs}}{{.}}
+{{end}}</pre>
+</body>
+</html>
+`))
+
+// ringBuffer stores the most recent values added to it.
+type ringBuffer struct {
+	values []float64
+	start  int
+	count  int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{values: make([]float64, capacity)}
+}
+
+// Add adds a value, replacing the oldest value if the
+// buffer is full.
+func (r *ringBuffer) Add(x float64) {
+	if r.count < len(r.values) {
+		r.values[(r.start+r.count)%len(r.values)] = x
+		r.count++
+	} else {
+		r.values[r.start] = x
+		r.start = (r.start + 1) % len(r.values)
+	}
+}
+
+// Values returns the values from oldest to newest.
+func (r *ringBuffer) Values() []float64 {
+	res := make([]float64, r.count)
+	for i := range res {
+		res[i] = r.values[(r.start+i)%len(r.values)]
+	}
+	return res
+}
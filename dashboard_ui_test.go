@@ -0,0 +1,101 @@
+package hessfree
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingBuffer(t *testing.T) {
+	buf := newRingBuffer(3)
+	for i := 1; i <= 5; i++ {
+		buf.Add(float64(i))
+	}
+	values := buf.Values()
+	if len(values) != 3 || values[0] != 3 || values[1] != 4 || values[2] != 5 {
+		t.Error("unexpected values:", values)
+	}
+}
+
+func TestDashboardUINegativeHistory(t *testing.T) {
+	if ui, err := NewDashboardUI("localhost:0", -1); err == nil {
+		ui.Close()
+		t.Error("expected an error for a negative history")
+	}
+}
+
+func TestDashboardUI(t *testing.T) {
+	ui, err := NewDashboardUI("localhost:0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ui.Close()
+	_, port, _ := net.SplitHostPort(ui.Addr().String())
+
+	ui.LogNewMiniBatch(2, 7)
+	ui.LogCGStart(3, 4)
+	ui.LogCGIteration(0.1, 2)
+	ui.LogUpdate(1, 2.5)
+	ui.LogDamping(0.5, 1.5)
+	ui.LogBacktrack(1, 2.7)
+	ui.LogReductionRatio(0.8)
+	ui.LogTiming(TimingCG, time.Second)
+
+	recorder := httptest.NewRecorder()
+	ui.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	page := recorder.Body.String()
+	if !strings.Contains(page, "Epoch 2, mini-batch 7") {
+		t.Error("page does not show progress")
+	}
+	if !strings.Contains(page, "<polyline") {
+		t.Error("page does not contain plots")
+	}
+	for _, title := range []string{"Reduction ratio", "backtracking", "Timing for cg"} {
+		if !strings.Contains(page, title) {
+			t.Error("page does not contain plot:", title)
+		}
+	}
+
+	if ui.ShouldStop() {
+		t.Fatal("should not stop yet")
+	}
+	recorder = httptest.NewRecorder()
+	ui.ServeHTTP(recorder, httptest.NewRequest("GET", "/stop", nil))
+	if ui.ShouldStop() {
+		t.Error("GET should not stop training")
+	}
+
+	req, err := http.NewRequest("POST", "http://"+ui.Addr().String()+"/stop", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "http://evil.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || ui.ShouldStop() {
+		t.Error("cross-origin POST should be rejected")
+	}
+
+	req = httptest.NewRequest("POST", "/stop", nil)
+	req.Host = "evil.example.com:" + port
+	recorder = httptest.NewRecorder()
+	ui.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden || ui.ShouldStop() {
+		t.Error("POST with a foreign host should be rejected")
+	}
+
+	resp, err = http.Post("http://"+ui.Addr().String()+"/stop", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !ui.ShouldStop() {
+		t.Error("POST should stop training")
+	}
+}
@@ -0,0 +1,103 @@
+package hessfree
+
+import (
+	"math"
+	"sort"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const (
+	jacobiMaxSweeps = 100
+	jacobiEpsilon   = 1e-24
+)
+
+// symmetricEigen computes the eigenvalues and eigenvectors
+// of a symmetric matrix using the cyclic Jacobi method.
+//
+// The eigenvalues are sorted in ascending order, and the
+// i-th column of the returned matrix is a unit eigenvector
+// for the i-th eigenvalue.
+func symmetricEigen(m *linalg.Matrix) (linalg.Vector, *linalg.Matrix) {
+	n := m.Rows
+	a := &linalg.Matrix{Rows: n, Cols: n, Data: append([]float64{}, m.Data...)}
+	v := linalg.NewMatrix(n, n)
+	for i := 0; i < n; i++ {
+		v.Set(i, i, 1)
+	}
+
+	for sweep := 0; sweep < jacobiMaxSweeps; sweep++ {
+		var off, total float64
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				x := a.Get(i, j)
+				total += x * x
+				if i != j {
+					off += x * x
+				}
+			}
+		}
+		if off <= jacobiEpsilon*total {
+			break
+		}
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				jacobiRotate(a, v, p, q)
+			}
+		}
+	}
+
+	values := make(linalg.Vector, n)
+	order := make([]int, n)
+	for i := range values {
+		values[i] = a.Get(i, i)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return values[order[i]] < values[order[j]]
+	})
+
+	sortedValues := make(linalg.Vector, n)
+	sortedVectors := linalg.NewMatrix(n, n)
+	for newIdx, oldIdx := range order {
+		sortedValues[newIdx] = values[oldIdx]
+		for row := 0; row < n; row++ {
+			sortedVectors.Set(row, newIdx, v.Get(row, oldIdx))
+		}
+	}
+	return sortedValues, sortedVectors
+}
+
+// jacobiRotate applies a rotation to a which zeroes the
+// entries at (p, q) and (q, p), accumulating the rotation
+// into v.
+func jacobiRotate(a, v *linalg.Matrix, p, q int) {
+	apq := a.Get(p, q)
+	if apq == 0 {
+		return
+	}
+	theta := (a.Get(q, q) - a.Get(p, p)) / (2 * apq)
+	t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+	if theta < 0 {
+		t = -t
+	}
+	c := 1 / math.Sqrt(t*t+1)
+	s := t * c
+
+	n := a.Rows
+	for k := 0; k < n; k++ {
+		akp, akq := a.Get(k, p), a.Get(k, q)
+		a.Set(k, p, c*akp-s*akq)
+		a.Set(k, q, s*akp+c*akq)
+	}
+	for k := 0; k < n; k++ {
+		apk, aqk := a.Get(p, k), a.Get(q, k)
+		a.Set(p, k, c*apk-s*aqk)
+		a.Set(q, k, s*apk+c*aqk)
+	}
+	for k := 0; k < n; k++ {
+		vkp, vkq := v.Get(k, p), v.Get(k, q)
+		v.Set(k, p, c*vkp-s*vkq)
+		v.Set(k, q, s*vkp+c*vkq)
+	}
+}
@@ -0,0 +1,232 @@
+package hessfree
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"gonum.org/v1/gonum/blas/blas64"
+)
+
+// A ParamLayout assigns every variable in an ordered
+// list of parameters to a range of a flat vector.
+type ParamLayout struct {
+	params  []*autofunc.Variable
+	offsets []int
+	indices map[*autofunc.Variable]int
+	names   []string
+	size    int
+}
+
+// NewParamLayout creates a layout in which the variables
+// are stored back to back, in the order given.
+// The layout uses the current lengths of the variables.
+func NewParamLayout(params []*autofunc.Variable) *ParamLayout {
+	res := &ParamLayout{
+		params:  make([]*autofunc.Variable, len(params)),
+		offsets: make([]int, len(params)),
+		indices: map[*autofunc.Variable]int{},
+	}
+	copy(res.params, params)
+	for i, param := range params {
+		if _, ok := res.indices[param]; ok {
+			panic("duplicate variable in layout")
+		}
+		res.indices[param] = i
+		res.offsets[i] = res.size
+		res.size += len(param.Vector)
+	}
+	return res
+}
+
+// NewNamedParamLayout is like NewParamLayout, but it also
+// assigns a unique name to every variable.
+// Names are used to identify variables in JSON encodings.
+func NewNamedParamLayout(params []*autofunc.Variable, names []string) *ParamLayout {
+	if len(names) != len(params) {
+		panic("name count must match parameter count")
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			panic("duplicate name in layout: " + name)
+		}
+		seen[name] = true
+	}
+	res := NewParamLayout(params)
+	res.names = make([]string, len(names))
+	copy(res.names, names)
+	return res
+}
+
+// Len returns the total number of entries in the layout.
+func (p *ParamLayout) Len() int {
+	return p.size
+}
+
+// Params returns the variables in the layout, in order.
+func (p *ParamLayout) Params() []*autofunc.Variable {
+	return p.params
+}
+
+// Index returns the index of a variable in the layout.
+// The second return value is false if the variable is not
+// part of the layout.
+func (p *ParamLayout) Index(v *autofunc.Variable) (int, bool) {
+	idx, ok := p.indices[v]
+	return idx, ok
+}
+
+// Name returns the name of the variable at the given
+// index in the layout.
+// If the layout was not created with names, the name is
+// the decimal representation of the index.
+func (p *ParamLayout) Name(idx int) string {
+	if p.names == nil {
+		return strconv.Itoa(idx)
+	}
+	return p.names[idx]
+}
+
+// Range returns the start and end offsets of the given
+// variable in a flat vector.
+// It panics if the variable is not part of the layout.
+func (p *ParamLayout) Range(v *autofunc.Variable) (start, end int) {
+	idx, ok := p.indices[v]
+	if !ok {
+		panic("variable not in layout")
+	}
+	start = p.offsets[idx]
+	return start, start + len(p.params[idx].Vector)
+}
+
+// Flatten converts a ConstParamDelta into a flat vector.
+// Variables missing from c are treated as zero vectors.
+// It panics if c contains variables outside the layout or
+// if any vector length does not match the layout.
+func (p *ParamLayout) Flatten(c ConstParamDelta) linalg.Vector {
+	res := make(linalg.Vector, p.size)
+	p.flattenInto(res, c)
+	return res
+}
+
+// Unflatten converts a flat vector into a ConstParamDelta
+// which contains every variable in the layout.
+// The vectors in the result share memory with v, so that
+// changes to one are reflected in the other.
+func (p *ParamLayout) Unflatten(v linalg.Vector) ConstParamDelta {
+	if len(v) != p.size {
+		panic(fmt.Sprintf("flat vector has length %d but layout needs %d", len(v), p.size))
+	}
+	res := make(ConstParamDelta, len(p.params))
+	for i, param := range p.params {
+		start := p.offsets[i]
+		end := start + len(param.Vector)
+		res[param] = v[start:end:end]
+	}
+	return res
+}
+
+func (p *ParamLayout) flattenInto(dest linalg.Vector, c ConstParamDelta) {
+	for variable, vec := range c {
+		start, end := p.Range(variable)
+		if len(vec) != end-start {
+			panic(fmt.Sprintf("delta has length %d but layout expects %d",
+				len(vec), end-start))
+		}
+	}
+	for i, param := range p.params {
+		start := p.offsets[i]
+		dest := dest[start : start+len(param.Vector)]
+		if vec, ok := c[param]; ok {
+			copy(dest, vec)
+		} else {
+			for j := range dest {
+				dest[j] = 0
+			}
+		}
+	}
+}
+
+// A FlatParamDelta stores the entries of a parameter
+// delta in one contiguous vector.
+type FlatParamDelta struct {
+	Layout *ParamLayout
+	Vector linalg.Vector
+
+	delta ConstParamDelta
+}
+
+// NewFlatParamDelta creates a zero delta for a layout.
+func NewFlatParamDelta(l *ParamLayout) *FlatParamDelta {
+	return &FlatParamDelta{
+		Layout: l,
+		Vector: make(linalg.Vector, l.Len()),
+	}
+}
+
+// FlattenDelta creates a FlatParamDelta with the entries
+// of a ConstParamDelta.
+func FlattenDelta(l *ParamLayout, c ConstParamDelta) *FlatParamDelta {
+	return &FlatParamDelta{
+		Layout: l,
+		Vector: l.Flatten(c),
+	}
+}
+
+// Delta returns a ConstParamDelta which shares memory
+// with the flat vector.
+func (f *FlatParamDelta) Delta() ConstParamDelta {
+	if f.delta == nil {
+		f.delta = f.Layout.Unflatten(f.Vector)
+	}
+	return f.delta
+}
+
+// SetDelta copies the entries of c into the flat vector.
+// Variables missing from c are set to zero.
+func (f *FlatParamDelta) SetDelta(c ConstParamDelta) {
+	f.Layout.flattenInto(f.Vector, c)
+}
+
+// Dot returns the dot product of two flat deltas.
+func (f *FlatParamDelta) Dot(f1 *FlatParamDelta) float64 {
+	return blas64.Dot(blasVector(f.Vector), blasVector(f1.Vector))
+}
+
+// Norm returns the Euclidean norm of the delta.
+func (f *FlatParamDelta) Norm() float64 {
+	return math.Sqrt(f.Dot(f))
+}
+
+// Axpy adds scaler*f1 to f in place.
+func (f *FlatParamDelta) Axpy(scaler float64, f1 *FlatParamDelta) {
+	blas64.Axpy(scaler, blasVector(f1.Vector), blasVector(f.Vector))
+}
+
+// Scale scales the delta in place.
+func (f *FlatParamDelta) Scale(scaler float64) {
+	blas64.Scal(scaler, blasVector(f.Vector))
+}
+
+// CopyFrom copies the entries of f1 into f.
+func (f *FlatParamDelta) CopyFrom(f1 *FlatParamDelta) {
+	copy(f.Vector, f1.Vector)
+}
+
+// Zero sets every entry of the delta to zero.
+func (f *FlatParamDelta) Zero() {
+	for i := range f.Vector {
+		f.Vector[i] = 0
+	}
+}
+
+// Clone returns a deep copy of the delta.
+func (f *FlatParamDelta) Clone() *FlatParamDelta {
+	return &FlatParamDelta{
+		Layout: f.Layout,
+		Vector: f.Vector.Copy(),
+	}
+}
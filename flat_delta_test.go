@@ -0,0 +1,126 @@
+package hessfree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/sgd"
+)
+
+func TestParamLayoutRoundTrip(t *testing.T) {
+	d1, _ := paramDeltaTestDeltas(7)
+	var params []*autofunc.Variable
+	for v := range d1 {
+		params = append(params, v)
+	}
+	layout := NewParamLayout(params)
+	if layout.Len() != 7+3+1 {
+		t.Fatal("unexpected layout length", layout.Len())
+	}
+
+	flat := layout.Flatten(d1)
+	for i, param := range params {
+		start, end := layout.Range(param)
+		if idx, _ := layout.Index(param); idx != i {
+			t.Error("expected index", i, "but got", idx)
+		}
+		for j, x := range d1[param] {
+			if flat[start+j] != x {
+				t.Fatal("bad flat entry for variable", i)
+			}
+		}
+		if end-start != len(d1[param]) {
+			t.Error("bad range for variable", i)
+		}
+	}
+	paramDeltaTestEquiv(t, layout.Unflatten(flat), d1)
+
+	partial := ConstParamDelta{params[0]: d1[params[0]]}
+	expected := d1.CloneShape()
+	expected[params[0]] = d1[params[0]]
+	paramDeltaTestEquiv(t, layout.Unflatten(layout.Flatten(partial)), expected)
+}
+
+func TestFlatParamDeltaShared(t *testing.T) {
+	d1, d2 := paramDeltaTestDeltas(5)
+	var params []*autofunc.Variable
+	for v := range d1 {
+		params = append(params, v)
+	}
+	layout := NewParamLayout(params)
+
+	flat1 := FlattenDelta(layout, d1)
+	flat2 := FlattenDelta(layout, d2)
+	if math.Abs(flat1.Dot(flat2)-d1.Dot(d2)) > paramDeltaTestPrec {
+		t.Error("expected dot product", d1.Dot(d2), "but got", flat1.Dot(flat2))
+	}
+
+	flat1.Axpy(2, flat2)
+	d1.Axpy(2, d2)
+	paramDeltaTestEquiv(t, flat1.Delta(), d1)
+
+	flat1.Delta()[params[0]][0] = 1337
+	if flat1.Vector[0] != 1337 {
+		t.Error("unflattened delta should share memory")
+	}
+}
+
+func TestFlatCG(t *testing.T) {
+	obj, delta := objectiveTestFunc()
+	samples := objectiveTestSamples(10)
+	var params []*autofunc.Variable
+	for v := range delta {
+		params = append(params, v)
+	}
+	learner := &paramsLearner{params}
+
+	var solutions []ConstParamDelta
+	for _, flat := range []bool{false, true} {
+		solver := cgSolver{
+			Trainer: &Trainer{
+				Learner: learner,
+				UI:      nopUI{},
+				FlatCG:  flat,
+			},
+			Objective: &ConcurrentObjective{Wrapped: obj},
+			Samples:   samples,
+		}
+		for i := 0; i < 5 && solver.Step(); i++ {
+		}
+		solutions = append(solutions, solver.Solution)
+	}
+
+	for v, expected := range solutions[0] {
+		actual := solutions[1][v]
+		for i, x := range expected {
+			if math.Abs(actual[i]-x) > objectiveTestPrec {
+				t.Fatal("entry", i, "should be", x, "but got", actual[i])
+			}
+		}
+	}
+}
+
+type paramsLearner struct {
+	params []*autofunc.Variable
+}
+
+func (p *paramsLearner) Parameters() []*autofunc.Variable {
+	return p.params
+}
+
+func (p *paramsLearner) MakeObjective() Objective {
+	panic("not implemented")
+}
+
+func (p *paramsLearner) Adjust(d, m ConstParamDelta, s sgd.SampleSet) {
+	d.addToVars()
+}
+
+type nopUI struct{}
+
+func (_ nopUI) LogCGStart(initQuad, quadLast float64)        {}
+func (_ nopUI) LogCGIteration(stepSize, quadValue float64)   {}
+func (_ nopUI) LogNewMiniBatch(epochNumber, batchNumber int) {}
+func (_ nopUI) Log(sender, message string)                   {}
+func (_ nopUI) ShouldStop() bool                             { return false }
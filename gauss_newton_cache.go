@@ -0,0 +1,198 @@
+package hessfree
+
+import (
+	"math"
+	"sync"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// cacheLinearTolerance is the maximum relative error for
+// which a new point is treated as a step along the last
+// direction.
+const cacheLinearTolerance = 1e-8
+
+// maxGaussNewtonCacheEntries is the maximum number of
+// sample sets for which a gaussNewtonCache stores state.
+const maxGaussNewtonCacheEntries = 1024
+
+// gaussNewtonCache stores per-batch values which do not
+// change while the parameters are held constant.
+//
+// Entries are keyed by the identity of the sample sets
+// (see sampleSetKey) and live as long as the cache, which
+// is usually a single mini-batch since Learners create a
+// new GaussNewtonNN for every objective.
+// If there are more than maxGaussNewtonCacheEntries
+// entries, the oldest ones are dropped.
+type gaussNewtonCache struct {
+	lock    sync.Mutex
+	entries map[sampleSetKey]*gaussNewtonEntry
+	order   []sampleSetKey
+}
+
+// entry returns the cache entry for a sample set, or nil
+// if the sample set cannot be identified.
+func (g *gaussNewtonCache) entry(s sgd.SampleSet) *gaussNewtonEntry {
+	key, ok := newSampleSetKey(s)
+	if !ok {
+		return nil
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.entries == nil {
+		g.entries = map[sampleSetKey]*gaussNewtonEntry{}
+	}
+	if e, ok := g.entries[key]; ok {
+		return e
+	}
+	if len(g.order) == maxGaussNewtonCacheEntries {
+		delete(g.entries, g.order[0])
+		g.order = g.order[1:]
+	}
+	e := newGaussNewtonEntry(s)
+	g.entries[key] = e
+	g.order = append(g.order, key)
+	return e
+}
+
+// gaussNewtonEntry stores the state of a batch at the
+// linearization point: the joined samples, the output X0
+// of the layers, and the value F0 and gradient Grad of the
+// output function at X0.
+//
+// It also remembers the last point and direction passed
+// to QuadHessian, along with their images under the
+// Jacobian J of the layers and the Hessian H of the
+// output function.
+// During CG, each new point is the last point plus a
+// multiple of the last direction, so J and H can be
+// applied to it by linearity.
+type gaussNewtonEntry struct {
+	Lock sync.Mutex
+
+	// Samples keeps the sample set (and thus its key) from
+	// being garbage collected while the entry exists.
+	Samples sgd.SampleSet
+
+	Ins     linalg.Vector
+	Outs    linalg.Vector
+	Weights linalg.Vector
+
+	X0   linalg.Vector
+	F0   float64
+	Grad linalg.Vector
+
+	LastX   ConstParamDelta
+	LastD   ConstParamDelta
+	LastJx  linalg.Vector
+	LastJd  linalg.Vector
+	LastHJx linalg.Vector
+	LastHJd linalg.Vector
+}
+
+func newGaussNewtonEntry(s sgd.SampleSet) *gaussNewtonEntry {
+	res := &gaussNewtonEntry{Samples: s}
+	res.Ins, res.Outs, res.Weights = joinSamples(s)
+	return res
+}
+
+// quadHessian implements QuadHessian using the entry for
+// the sample set.
+// The result is not normalized.
+func (g *GaussNewtonNN) quadHessian(e *gaussNewtonEntry, delta, x ConstParamDelta,
+	n int) (ConstParamDelta, float64) {
+	e.Lock.Lock()
+	defer e.Lock.Unlock()
+
+	// Like the R-operator approach, only use the parts of x
+	// which correspond to entries of delta.
+	point := ConstParamDelta{}
+	for variable := range delta {
+		if vec, ok := x[variable]; ok {
+			point[variable] = vec
+		}
+	}
+
+	outFunc := g.outFunc(e.Outs, e.Weights, n)
+	pass := newGaussNewtonPass(g.Layers, outFunc, delta, e.Ins, n, e.X0)
+	if e.X0 == nil {
+		e.X0, e.F0 = pass.X0, pass.F0
+	}
+
+	var jx, hjx linalg.Vector
+	var value float64
+	if alpha, ok := e.stepSize(point); ok {
+		jx = e.LastJx.Copy().Add(e.LastJd.Copy().Scale(alpha))
+		hjx = e.LastHJx.Copy().Add(e.LastHJd.Copy().Scale(alpha))
+		if e.Grad == nil {
+			e.Grad = outputGradient(outFunc, e.X0)
+		}
+		value = e.F0 + e.Grad.Dot(jx) + 0.5*jx.Dot(hjx)
+	} else if point.Norm() == 0 {
+		jx = make(linalg.Vector, len(e.X0))
+		hjx = make(linalg.Vector, len(e.X0))
+		value = e.F0
+	} else {
+		insRVar := autofunc.NewRVariable(&autofunc.Variable{Vector: e.Ins},
+			autofunc.RVector{})
+		xVec := autofunc.RVector{}
+		for variable, vec := range point {
+			xVec[variable] = vec
+		}
+		jx = g.Layers.BatchR(xVec, insRVar, n).ROutput()
+		var deriv float64
+		hjx, _, deriv = outputHessian(outFunc, e.X0, jx)
+		value = e.F0 + deriv + 0.5*jx.Dot(hjx)
+	}
+
+	if g.CacheBatchState {
+		e.LastX = point.Clone()
+		e.LastD = delta.Clone()
+		e.LastJx, e.LastJd = jx, pass.JV
+		e.LastHJx, e.LastHJd = hjx, pass.HJV
+	}
+
+	return pass.Product, value
+}
+
+// outputGradient computes the gradient of f at x0.
+func outputGradient(f autofunc.RFunc, x0 linalg.Vector) linalg.Vector {
+	inVar := &autofunc.Variable{Vector: x0}
+	result := f.Apply(inVar)
+	grad := autofunc.NewGradient([]*autofunc.Variable{inVar})
+	result.PropagateGradient([]float64{1}, grad)
+	return grad[inVar]
+}
+
+// stepSize checks if x is the last point plus a multiple
+// of the last direction, returning the multiple.
+func (e *gaussNewtonEntry) stepSize(x ConstParamDelta) (float64, bool) {
+	if e.LastX == nil || len(x) != len(e.LastX) {
+		return 0, false
+	}
+	diff := ConstParamDelta{}
+	for variable, vec := range x {
+		lastVec, ok := e.LastX[variable]
+		if !ok || len(lastVec) != len(vec) {
+			return 0, false
+		}
+		if _, ok := e.LastD[variable]; !ok {
+			return 0, false
+		}
+		diff[variable] = vec.Copy().Add(lastVec.Copy().Scale(-1))
+	}
+	dirMag2 := e.LastD.Dot(e.LastD)
+	if dirMag2 == 0 {
+		return 0, false
+	}
+	alpha := diff.Dot(e.LastD) / dirMag2
+	diff.Axpy(-alpha, e.LastD)
+	if diff.Norm() > cacheLinearTolerance*math.Max(x.Norm(), e.LastX.Norm()) {
+		return 0, false
+	}
+	return alpha, true
+}
@@ -0,0 +1,184 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestGaussNewtonCache(t *testing.T) {
+	network, samples := gaussNewtonCacheTestNet(10, 5, 20)
+	params := network.Parameters()
+	uncached := &GaussNewtonNN{
+		Layers: network.BatchLearner(),
+		Cost:   neuralnet.SigmoidCECost{},
+	}
+	cached := &GaussNewtonNN{
+		Layers:          network.BatchLearner(),
+		Cost:            neuralnet.SigmoidCECost{},
+		CacheBatchState: true,
+	}
+
+	// Mimic the sequence of points and directions in CG,
+	// followed by an unrelated point.
+	x := gaussNewtonCacheTestDelta(params, 0)
+	for i := 0; i < 5; i++ {
+		d := gaussNewtonCacheTestDelta(params, learnerTestOffset)
+		if i == 4 {
+			x = gaussNewtonCacheTestDelta(params, learnerTestOffset)
+		}
+		expected, expectedVal := uncached.QuadHessian(d, x, samples)
+		actual, actualVal := cached.QuadHessian(d, x, samples)
+		if math.Abs(expectedVal-actualVal) > learnerTestPrec {
+			t.Errorf("step %d: expected value %f but got %f", i, expectedVal, actualVal)
+		}
+		diff := expected.Clone()
+		diff.Axpy(-1, actual)
+		if diff.Norm() > learnerTestPrec {
+			t.Errorf("step %d: product is off by %f", i, diff.Norm())
+		}
+		x.Axpy(rand.NormFloat64(), d)
+	}
+}
+
+func TestGaussNewtonCacheKeys(t *testing.T) {
+	_, samples := gaussNewtonCacheTestNet(3, 2, 50)
+	var cache gaussNewtonCache
+
+	entry := cache.entry(samples)
+	if cache.entry(samples) != entry || cache.entry(samples.Subset(0, 50)) != entry {
+		t.Error("the same samples should share an entry")
+	}
+	if cache.entry(samples.Copy()) == entry || cache.entry(samples.Subset(1, 50)) == entry {
+		t.Error("different sample sets should not share an entry")
+	}
+
+	for i := 0; i < samples.Len(); i++ {
+		for j := i + 1; j <= samples.Len(); j++ {
+			cache.entry(samples.Subset(i, j))
+		}
+	}
+	if len(cache.entries) != maxGaussNewtonCacheEntries ||
+		len(cache.order) != maxGaussNewtonCacheEntries {
+		t.Error("expected", maxGaussNewtonCacheEntries, "entries but got", len(cache.entries))
+	}
+	if _, ok := cache.entries[cache.order[0]]; !ok {
+		t.Error("order should match entries")
+	}
+}
+
+func TestGaussNewtonCachePointerKeys(t *testing.T) {
+	_, samples := gaussNewtonCacheTestNet(3, 2, 10)
+	ptrSamples := &ptrSampleSet{Samples: samples.Subset(0, samples.Len())}
+	var cache gaussNewtonCache
+
+	// The same pointer always hits.
+	entry := cache.entry(ptrSamples)
+	if cache.entry(ptrSamples) != entry {
+		t.Error("the same pointer should share an entry")
+	}
+
+	// Every Subset call allocates a new set, so each call
+	// misses and adds an entry.
+	first := cache.entry(ptrSamples.Subset(0, 5))
+	if cache.entry(ptrSamples.Subset(0, 5)) == first {
+		t.Error("fresh subsets should not share an entry")
+	}
+	if len(cache.entries) != 3 {
+		t.Error("expected 3 entries but got", len(cache.entries))
+	}
+}
+
+func BenchmarkGaussNewtonNNQuadHessian(b *testing.B) {
+	for _, cache := range []bool{false, true} {
+		name := "Uncached"
+		if cache {
+			name = "Cached"
+		}
+		b.Run(name, func(b *testing.B) {
+			network, samples := gaussNewtonCacheTestNet(100, 300, 15)
+			params := network.Parameters()
+			objective := &GaussNewtonNN{
+				Layers:          network.BatchLearner(),
+				Cost:            neuralnet.SigmoidCECost{},
+				CacheBatchState: cache,
+			}
+			x := gaussNewtonCacheTestDelta(params, 0)
+			d := gaussNewtonCacheTestDelta(params, learnerTestOffset)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				objective.QuadHessian(d, x, samples)
+				x.Axpy(0.1, d)
+			}
+		})
+	}
+}
+
+func gaussNewtonCacheTestNet(inSize, hiddenSize, count int) (neuralnet.Network,
+	sgd.SampleSet) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  inSize,
+			OutputCount: hiddenSize,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  hiddenSize,
+			OutputCount: inSize,
+		},
+	}
+	network.Randomize()
+
+	var inputs []linalg.Vector
+	for i := 0; i < count; i++ {
+		vec := make(linalg.Vector, inSize)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	return network, neuralnet.VectorSampleSet(inputs, inputs)
+}
+
+func gaussNewtonCacheTestDelta(params []*autofunc.Variable, scale float64) ConstParamDelta {
+	res := ConstParamDelta{}
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64() * scale
+		}
+		res[param] = vec
+	}
+	return res
+}
+
+// ptrSampleSet is a pointer-kind SampleSet whose Subset
+// allocates a new set on every call.
+type ptrSampleSet struct {
+	Samples sgd.SampleSet
+}
+
+func (p *ptrSampleSet) Len() int {
+	return p.Samples.Len()
+}
+
+func (p *ptrSampleSet) Swap(i, j int) {
+	p.Samples.Swap(i, j)
+}
+
+func (p *ptrSampleSet) GetSample(i int) interface{} {
+	return p.Samples.GetSample(i)
+}
+
+func (p *ptrSampleSet) Copy() sgd.SampleSet {
+	return &ptrSampleSet{Samples: p.Samples.Copy()}
+}
+
+func (p *ptrSampleSet) Subset(i, j int) sgd.SampleSet {
+	return &ptrSampleSet{Samples: p.Samples.Subset(i, j)}
+}
@@ -0,0 +1,94 @@
+package hessfree
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// A TargetCost creates a cost function for a batch of
+// outputs, given the expected outputs for the batch.
+// The resulting function should map the concatenated
+// outputs of a batch to a single value, the total cost.
+type TargetCost func(targets linalg.Vector) autofunc.RFunc
+
+// A GenericLearner is a Learner which wraps an arbitrary
+// autofunc.RBatcher and creates concurrent Gauss-Newton
+// objectives for it.
+//
+// Samples must be neuralnet.VectorSamples or
+// WeightedSamples, where the input of each sample is fed
+// to the model and the output of each sample is the target
+// passed to the cost.
+type GenericLearner struct {
+	// Model is the part of the model which is linearized
+	// for the Gauss-Newton approximation.
+	Model autofunc.RBatcher
+
+	// Output is an optional output layer which is applied
+	// to the outputs of Model before the cost.
+	// Like the output layer of a GaussNewtonNN, it should
+	// match the cost to ensure a convex approximation.
+	Output autofunc.RBatcher
+
+	// Params are the learnable parameters of Model.
+	Params []*autofunc.Variable
+
+	// Cost computes the total cost of a batch.
+	Cost TargetCost
+
+	// Parameters for the ConcurrentObjectives.
+	MaxSubBatch    int
+	MaxConcurrency int
+
+	// Normalize specifies that the objectives should be
+	// mean costs per sample rather than total costs.
+	Normalize bool
+}
+
+// Parameters returns g.Params.
+func (g *GenericLearner) Parameters() []*autofunc.Variable {
+	return g.Params
+}
+
+// Normalized returns g.Normalize.
+func (g *GenericLearner) Normalized() bool {
+	return g.Normalize
+}
+
+// MakeObjective creates a ConcurrentObjective which
+// wraps a Gauss-Newton objective.
+func (g *GenericLearner) MakeObjective() Objective {
+	return &ConcurrentObjective{
+		Wrapped: &GaussNewtonNN{
+			Layers: g.Model,
+			Output: g.Output,
+			Cost:   targetCostFunc{g.Cost},
+
+			CacheBatchState: true,
+		},
+		MaxConcurrency: g.MaxConcurrency,
+		MaxSubBatch:    g.MaxSubBatch,
+		Normalize:      g.Normalize,
+	}
+}
+
+// Adjust adds the delta to its parameters.
+func (g *GenericLearner) Adjust(d, m ConstParamDelta, s sgd.SampleSet) {
+	d.addToVars()
+}
+
+// targetCostFunc implements neuralnet.CostFunc using a
+// TargetCost.
+type targetCostFunc struct {
+	F TargetCost
+}
+
+func (t targetCostFunc) Cost(expected linalg.Vector, actual autofunc.Result) autofunc.Result {
+	return t.F(expected).Apply(actual)
+}
+
+func (t targetCostFunc) CostR(v autofunc.RVector, expected linalg.Vector,
+	actual autofunc.RResult) autofunc.RResult {
+	return t.F(expected).ApplyR(v, actual)
+}
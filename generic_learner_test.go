@@ -0,0 +1,84 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestGenericLearner(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  10,
+			OutputCount: 5,
+		},
+		&neuralnet.HyperbolicTangent{},
+		&neuralnet.DenseLayer{
+			InputCount:  5,
+			OutputCount: 3,
+		},
+	}
+	network.Randomize()
+
+	learner := &GenericLearner{
+		Model:          network.BatchLearner(),
+		Params:         network.Parameters(),
+		Cost:           genericTestCost,
+		MaxSubBatch:    4,
+		MaxConcurrency: 2,
+	}
+
+	var inputs, outputs []linalg.Vector
+	for i := 0; i < 10; i++ {
+		in := make(linalg.Vector, 10)
+		for i := range in {
+			in[i] = rand.NormFloat64()
+		}
+		out := make(linalg.Vector, 3)
+		for i := range out {
+			out[i] = rand.NormFloat64()
+		}
+		inputs = append(inputs, in)
+		outputs = append(outputs, out)
+	}
+	samples := neuralnet.VectorSampleSet(inputs, outputs)
+
+	testLearner(t, learner, samples)
+
+	var expected float64
+	for i, in := range inputs {
+		out := network.Batch(&autofunc.Variable{Vector: in}, 1).Output()
+		for j, x := range out {
+			diff := x - outputs[i][j]
+			expected += diff * diff
+		}
+	}
+	actual := learner.MakeObjective().Objective(ConstParamDelta{}, samples)
+	if math.Abs(actual-expected) > learnerTestPrec {
+		t.Error("objective should be", expected, "but got", actual)
+	}
+}
+
+func genericTestCost(targets linalg.Vector) autofunc.RFunc {
+	return genericTestSquaredError{targets}
+}
+
+type genericTestSquaredError struct {
+	Targets linalg.Vector
+}
+
+func (g genericTestSquaredError) Apply(in autofunc.Result) autofunc.Result {
+	negTargets := &autofunc.Variable{Vector: g.Targets.Copy().Scale(-1)}
+	return autofunc.SumAll(autofunc.Pow(autofunc.Add(in, negTargets), 2))
+}
+
+func (g genericTestSquaredError) ApplyR(v autofunc.RVector,
+	in autofunc.RResult) autofunc.RResult {
+	negTargets := &autofunc.Variable{Vector: g.Targets.Copy().Scale(-1)}
+	negRTargets := autofunc.NewRVariable(negTargets, v)
+	return autofunc.SumAllR(autofunc.PowR(autofunc.AddR(in, negRTargets), 2))
+}
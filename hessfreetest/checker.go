@@ -0,0 +1,265 @@
+// Package hessfreetest provides utilities for testing
+// implementations of hessfree.Objective.
+package hessfreetest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/hessfree"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+const (
+	defaultEpsilon = 1e-5
+	defaultScale   = 1e-1
+)
+
+// A Checker compares the methods of an Objective against
+// finite differences and against each other.
+//
+// Errors are absolute differences divided by the larger
+// of 1 and the magnitude of the expected value, so they
+// are relative for large values.
+type Checker struct {
+	Objective hessfree.Objective
+	Samples   sgd.SampleSet
+
+	// Params are the variables to check.
+	Params []*autofunc.Variable
+
+	// Epsilon is the step size for finite differences.
+	// Second differences divide by the square of the step
+	// size, so they use the square root of Epsilon instead.
+	// If this is 0, a reasonable default is used.
+	Epsilon float64
+
+	// Scale is the standard deviation of the random deltas
+	// at which the derivatives are checked.
+	// If this is 0, a reasonable default is used.
+	Scale float64
+}
+
+// VariableErrors stores the errors for one variable.
+type VariableErrors struct {
+	Variable *autofunc.Variable
+
+	// GradError is the largest error in an entry of
+	// QuadGrad, compared to central differences of Quad.
+	GradError float64
+
+	// HessianError is the largest error in an entry of
+	// QuadHessian, compared to central differences of
+	// QuadGrad along the same direction.
+	HessianError float64
+
+	// ModelError is the error between the derivative of
+	// Objective at zero along a random direction in this
+	// variable and the derivative of the quadratic model
+	// along the same direction.
+	// If the model matches Objective to second order, this
+	// error shrinks quadratically with Epsilon.
+	ModelError float64
+
+	// CurvatureError is the error between d^T*H*d and the
+	// second difference of Objective at zero along the same
+	// direction d as ModelError.
+	// Gauss-Newton and damped objectives only pass this
+	// check when their curvature matrix is the Hessian of
+	// Objective, e.g. when the network's outputs are linear
+	// in its parameters and there is no damping.
+	CurvatureError float64
+
+	// SymmetryError is the error between u^T*H*v and
+	// v^T*H*u, where v is random and u is random in this
+	// variable and zero elsewhere.
+	SymmetryError float64
+}
+
+// A Report summarizes the results of a Checker.
+type Report struct {
+	// Variables contains the errors for each variable, in
+	// the same order as the Checker's Params.
+	Variables []VariableErrors
+
+	// QuadValueError is the error between the value which
+	// QuadHessian reports and the result of Quad.
+	QuadValueError float64
+
+	// ZeroValueError is the error between Quad and
+	// Objective at a delta of zero.
+	ZeroValueError float64
+}
+
+// MaxError returns the largest error in the report.
+func (r *Report) MaxError() float64 {
+	res := math.Max(r.QuadValueError, r.ZeroValueError)
+	for _, v := range r.Variables {
+		for _, x := range []float64{v.GradError, v.HessianError, v.ModelError,
+			v.CurvatureError, v.SymmetryError} {
+			res = math.Max(res, x)
+		}
+	}
+	return res
+}
+
+// Check runs all of the checks.
+// The number of Quad evaluations is proportional to the
+// number of parameters, so this is meant for small models.
+func (c *Checker) Check() *Report {
+	eps := c.epsilon()
+	x := c.randomDelta(c.scale())
+	zero := c.randomDelta(0)
+
+	res := &Report{}
+
+	grad := c.Objective.QuadGrad(x, c.Samples)
+	dir := c.randomDelta(1)
+	product, quadValue := c.Objective.QuadHessian(dir, x, c.Samples)
+	res.QuadValueError = relError(quadValue, c.Objective.Quad(x, c.Samples))
+
+	fdProduct := c.gradDifference(x, dir, eps)
+	zeroGrad := c.Objective.QuadGrad(zero, c.Samples)
+	zeroObjective := c.Objective.Objective(zero, c.Samples)
+	dirProduct, _ := c.Objective.QuadHessian(dir, zero, c.Samples)
+
+	for _, param := range c.Params {
+		errs := VariableErrors{Variable: param}
+
+		vec := x[param]
+		for i := range vec {
+			old := vec[i]
+			vec[i] = old + eps
+			plus := c.Objective.Quad(x, c.Samples)
+			vec[i] = old - eps
+			minus := c.Objective.Quad(x, c.Samples)
+			vec[i] = old
+			expected := (plus - minus) / (2 * eps)
+			errs.GradError = math.Max(errs.GradError, relError(grad[param][i], expected))
+		}
+
+		for i, expected := range fdProduct[param] {
+			errs.HessianError = math.Max(errs.HessianError,
+				relError(product[param][i], expected))
+		}
+
+		paramDir := c.randomDelta(0)
+		for i := range paramDir[param] {
+			paramDir[param][i] = rand.NormFloat64()
+		}
+		errs.ModelError = relError(zeroGrad.Dot(paramDir), c.objectiveDerivative(paramDir, eps))
+
+		paramProduct, _ := c.Objective.QuadHessian(paramDir, zero, c.Samples)
+		errs.CurvatureError = relError(paramDir.Dot(paramProduct),
+			c.objectiveCurvature(paramDir, zeroObjective, math.Sqrt(eps)))
+		errs.SymmetryError = relError(dir.Dot(paramProduct), paramDir.Dot(dirProduct))
+
+		res.Variables = append(res.Variables, errs)
+	}
+
+	res.ZeroValueError = relError(c.Objective.Quad(zero, c.Samples), zeroObjective)
+
+	return res
+}
+
+// gradDifference approximates the Hessian-vector product
+// H*d using central differences of QuadGrad around x.
+func (c *Checker) gradDifference(x, d hessfree.ConstParamDelta,
+	eps float64) hessfree.ConstParamDelta {
+	plus := x.Clone()
+	plus.Axpy(eps, d)
+	minus := x.Clone()
+	minus.Axpy(-eps, d)
+	res := c.Objective.QuadGrad(plus, c.Samples).Clone()
+	res.Axpy(-1, c.Objective.QuadGrad(minus, c.Samples))
+	res.Scale(1 / (2 * eps))
+	return res
+}
+
+// objectiveDerivative approximates the derivative of the
+// true objective at zero along d.
+func (c *Checker) objectiveDerivative(d hessfree.ConstParamDelta, eps float64) float64 {
+	plus := d.Clone()
+	plus.Scale(eps)
+	minus := d.Clone()
+	minus.Scale(-eps)
+	return (c.Objective.Objective(plus, c.Samples) -
+		c.Objective.Objective(minus, c.Samples)) / (2 * eps)
+}
+
+// objectiveCurvature approximates the second derivative
+// of the true objective at zero along d, given the value
+// of the objective at zero.
+func (c *Checker) objectiveCurvature(d hessfree.ConstParamDelta, zeroValue,
+	eps float64) float64 {
+	plus := d.Clone()
+	plus.Scale(eps)
+	minus := d.Clone()
+	minus.Scale(-eps)
+	return (c.Objective.Objective(plus, c.Samples) - 2*zeroValue +
+		c.Objective.Objective(minus, c.Samples)) / (eps * eps)
+}
+
+func (c *Checker) randomDelta(scale float64) hessfree.ConstParamDelta {
+	res := hessfree.ConstParamDelta{}
+	for _, param := range c.Params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64() * scale
+		}
+		res[param] = vec
+	}
+	return res
+}
+
+func (c *Checker) epsilon() float64 {
+	if c.Epsilon == 0 {
+		return defaultEpsilon
+	}
+	return c.Epsilon
+}
+
+func (c *Checker) scale() float64 {
+	if c.Scale == 0 {
+		return defaultScale
+	}
+	return c.Scale
+}
+
+// CheckObjective runs a Checker with default settings and
+// reports every error greater than tol to t.
+func CheckObjective(t testing.TB, obj hessfree.Objective, params []*autofunc.Variable,
+	s sgd.SampleSet, tol float64) {
+	c := &Checker{Objective: obj, Samples: s, Params: params}
+	report := c.Check()
+	for i, v := range report.Variables {
+		if v.GradError > tol {
+			t.Errorf("variable %d: gradient error %e", i, v.GradError)
+		}
+		if v.HessianError > tol {
+			t.Errorf("variable %d: Hessian error %e", i, v.HessianError)
+		}
+		if v.ModelError > tol {
+			t.Errorf("variable %d: model error %e", i, v.ModelError)
+		}
+		if v.CurvatureError > tol {
+			t.Errorf("variable %d: curvature error %e", i, v.CurvatureError)
+		}
+		if v.SymmetryError > tol {
+			t.Errorf("variable %d: symmetry error %e", i, v.SymmetryError)
+		}
+	}
+	if report.QuadValueError > tol {
+		t.Errorf("QuadHessian value error %e", report.QuadValueError)
+	}
+	if report.ZeroValueError > tol {
+		t.Errorf("zero value error %e", report.ZeroValueError)
+	}
+}
+
+func relError(actual, expected float64) float64 {
+	return math.Abs(actual-expected) / math.Max(1, math.Abs(expected))
+}
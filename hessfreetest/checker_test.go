@@ -0,0 +1,142 @@
+package hessfreetest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/hessfree"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestCheckObjective(t *testing.T) {
+	// The network's outputs are linear in its parameters,
+	// so the Gauss-Newton matrix is the true Hessian.
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  4,
+			OutputCount: 4,
+		},
+	}
+	network.Randomize()
+	learner := &hessfree.NeuralNetLearner{
+		Layers:      network,
+		Cost:        neuralnet.SigmoidCECost{},
+		MaxSubBatch: 3,
+	}
+	samples := checkerTestSamples()
+
+	CheckObjective(t, learner.MakeObjective(), learner.Parameters(), samples, 1e-4)
+}
+
+func TestCheckerDamped(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  4,
+			OutputCount: 3,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  3,
+			OutputCount: 4,
+		},
+	}
+	network.Randomize()
+	learner := &hessfree.DampingLearner{
+		WrappedLearner: &hessfree.NeuralNetLearner{
+			Layers:      network,
+			Cost:        neuralnet.SigmoidCECost{},
+			MaxSubBatch: 3,
+		},
+		DampingCoeff: 0.1,
+	}
+	samples := checkerTestSamples()
+
+	checker := &Checker{
+		Objective: learner.MakeObjective(),
+		Samples:   samples,
+		Params:    learner.Parameters(),
+	}
+	report := checker.Check()
+	for i, v := range report.Variables {
+		for _, err := range []float64{v.GradError, v.HessianError, v.ModelError,
+			v.SymmetryError} {
+			if err > 1e-4 {
+				t.Errorf("variable %d: unexpected error in %+v", i, v)
+				break
+			}
+		}
+		// Damping adds curvature which Objective lacks.
+		if v.CurvatureError < 1e-2 {
+			t.Errorf("variable %d: expected curvature error", i)
+		}
+	}
+}
+
+func TestCheckerDetectsErrors(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  4,
+			OutputCount: 4,
+		},
+	}
+	network.Randomize()
+	learner := &hessfree.NeuralNetLearner{
+		Layers: network,
+		Cost:   neuralnet.SigmoidCECost{},
+	}
+	inputs := []linalg.Vector{{1, 2, 3, 4}, {-1, 0.5, 0, 1}}
+	samples := neuralnet.VectorSampleSet(inputs, inputs)
+
+	checker := &Checker{
+		Objective: &scaledGradObjective{Wrapped: learner.MakeObjective()},
+		Samples:   samples,
+		Params:    learner.Parameters(),
+	}
+	report := checker.Check()
+	for i, v := range report.Variables {
+		if v.GradError < 1e-3 {
+			t.Errorf("variable %d: expected gradient error", i)
+		}
+	}
+}
+
+func checkerTestSamples() sgd.SampleSet {
+	var inputs []linalg.Vector
+	for i := 0; i < 10; i++ {
+		vec := make(linalg.Vector, 4)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	return neuralnet.VectorSampleSet(inputs, inputs)
+}
+
+// scaledGradObjective has an incorrect gradient.
+type scaledGradObjective struct {
+	Wrapped hessfree.Objective
+}
+
+func (s *scaledGradObjective) Quad(delta hessfree.ConstParamDelta,
+	samples sgd.SampleSet) float64 {
+	return s.Wrapped.Quad(delta, samples)
+}
+
+func (s *scaledGradObjective) QuadGrad(delta hessfree.ConstParamDelta,
+	samples sgd.SampleSet) hessfree.ConstParamDelta {
+	res := s.Wrapped.QuadGrad(delta, samples).Clone()
+	res.Scale(2)
+	return res
+}
+
+func (s *scaledGradObjective) QuadHessian(delta, x hessfree.ConstParamDelta,
+	samples sgd.SampleSet) (hessfree.ConstParamDelta, float64) {
+	return s.Wrapped.QuadHessian(delta, x, samples)
+}
+
+func (s *scaledGradObjective) Objective(delta hessfree.ConstParamDelta,
+	samples sgd.SampleSet) float64 {
+	return s.Wrapped.Objective(delta, samples)
+}
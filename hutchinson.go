@@ -0,0 +1,126 @@
+package hessfree
+
+import (
+	"math"
+	"sync"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+const defaultHutchinsonProbes = 10
+
+// A HutchinsonEstimator estimates the trace and diagonal
+// of an objective's curvature matrix A using random
+// Rademacher probes v, as in Hutchinson (1990) and Bekas
+// et al. (2007).
+// Each probe costs one QuadHessian call.
+//
+// Standard errors are computed from the spread of the
+// per-probe estimates, and they are NaN if there are fewer
+// than two probes.
+type HutchinsonEstimator struct {
+	Objective QuadObjective
+
+	// Probes is the number of probes per estimate.
+	// If this is 0, a reasonable default is used.
+	Probes int
+
+	// MaxConcurrency is the maximum number of probes which
+	// are evaluated at once.
+	// If this is 0, GOMAXPROCS is used.
+	// Unless this is 1, the objective's methods must be
+	// concurrency-safe.
+	MaxConcurrency int
+}
+
+// Trace estimates the trace of A as the mean of v^T*A*v.
+func (h *HutchinsonEstimator) Trace(params []*autofunc.Variable,
+	s sgd.SampleSet) (trace, stdErr float64) {
+	var lock sync.Mutex
+	var sum, sumSq float64
+	probes := h.probes()
+	h.runProbes(params, s, func(probe, product ConstParamDelta) {
+		x := probe.Dot(product)
+		lock.Lock()
+		sum += x
+		sumSq += x * x
+		lock.Unlock()
+	})
+	return sum / float64(probes), standardError(sum, sumSq, probes)
+}
+
+// Diagonal estimates the diagonal of A as the mean of the
+// element-wise products v*(A*v).
+func (h *HutchinsonEstimator) Diagonal(params []*autofunc.Variable,
+	s sgd.SampleSet) (diag, stdErr ConstParamDelta) {
+	sum := ConstParamDelta{}
+	sumSq := ConstParamDelta{}
+	for _, param := range params {
+		sum[param] = make(linalg.Vector, len(param.Vector))
+		sumSq[param] = make(linalg.Vector, len(param.Vector))
+	}
+
+	var lock sync.Mutex
+	h.runProbes(params, s, func(probe, product ConstParamDelta) {
+		lock.Lock()
+		defer lock.Unlock()
+		for param, sumVec := range sum {
+			sumSqVec := sumSq[param]
+			probeVec := probe[param]
+			for i, x := range product[param] {
+				x *= probeVec[i]
+				sumVec[i] += x
+				sumSqVec[i] += x * x
+			}
+		}
+	})
+
+	probes := h.probes()
+	diag = ConstParamDelta{}
+	stdErr = ConstParamDelta{}
+	for param, sumVec := range sum {
+		sumSqVec := sumSq[param]
+		errVec := make(linalg.Vector, len(sumVec))
+		for i, x := range sumVec {
+			errVec[i] = standardError(x, sumSqVec[i], probes)
+		}
+		diag[param] = sumVec.Scale(1 / float64(probes))
+		stdErr[param] = errVec
+	}
+	return
+}
+
+// runProbes evaluates A*v for random probes v, calling f
+// with each probe and product.
+func (h *HutchinsonEstimator) runProbes(params []*autofunc.Variable, s sgd.SampleSet,
+	f func(probe, product ConstParamDelta)) {
+	zero := ConstParamDelta{}
+	for _, param := range params {
+		zero[param] = make(linalg.Vector, len(param.Vector))
+	}
+	parallelFor(h.probes(), h.MaxConcurrency, func(int) {
+		probe := rademacherDelta(params)
+		product, _ := h.Objective.QuadHessian(probe, zero, s)
+		f(probe, product)
+	})
+}
+
+func (h *HutchinsonEstimator) probes() int {
+	if h.Probes == 0 {
+		return defaultHutchinsonProbes
+	}
+	return h.Probes
+}
+
+// standardError computes the standard error of the mean
+// of n values, given their sum and sum of squares.
+func standardError(sum, sumSq float64, n int) float64 {
+	if n < 2 {
+		return math.NaN()
+	}
+	count := float64(n)
+	variance := (sumSq - sum*sum/count) / (count - 1)
+	return math.Sqrt(math.Max(variance, 0) / count)
+}
@@ -0,0 +1,180 @@
+package hessfree
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JSONUI is a UI which writes one JSON object per line for
+// every event, making logs easy to parse by machine.
+//
+// Every object has an "event" field naming the event, a
+// "time" field with an RFC 3339 timestamp, and a "step"
+// field which counts the events written so far.
+// Non-finite numbers are written as null.
+// Events also include "batch_step", the number of
+// mini-batches started so far, and "cg_step", the number
+// of CG iterations since the last CG start.
+type JSONUI struct {
+	writer io.Writer
+
+	lock      sync.Mutex
+	step      int64
+	batchStep int64
+	cgStep    int64
+	err       error
+
+	killFlag uint32
+}
+
+// NewJSONUI creates a JSONUI which writes to w.
+func NewJSONUI(w io.Writer) *JSONUI {
+	return &JSONUI{writer: w}
+}
+
+func (j *JSONUI) LogCGStart(initQuad, quadLast float64) {
+	j.write("cg_start", func() {
+		j.cgStep = 0
+	}, map[string]interface{}{
+		"quad":     initQuad,
+		"baseline": quadLast,
+	})
+}
+
+func (j *JSONUI) LogCGIteration(stepSize, quadValue float64) {
+	j.write("cg_iteration", func() {
+		j.cgStep++
+	}, map[string]interface{}{
+		"step_size": stepSize,
+		"quad":      quadValue,
+	})
+}
+
+func (j *JSONUI) LogNewMiniBatch(epochNum, batchNum int) {
+	j.write("mini_batch", func() {
+		j.batchStep++
+		j.cgStep = 0
+	}, map[string]interface{}{
+		"epoch": epochNum,
+		"batch": batchNum,
+	})
+}
+
+func (j *JSONUI) Log(sender, message string) {
+	j.write("log", nil, map[string]interface{}{
+		"sender":  sender,
+		"message": message,
+	})
+}
+
+// LogDamping writes a "damping" event.
+func (j *JSONUI) LogDamping(trust, coeff float64) {
+	j.write("damping", nil, map[string]interface{}{
+		"trust": trust,
+		"coeff": coeff,
+	})
+}
+
+// LogBacktrack writes a "backtrack" event.
+func (j *JSONUI) LogBacktrack(iteration int, objective float64) {
+	j.write("backtrack", nil, map[string]interface{}{
+		"iteration": iteration,
+		"objective": objective,
+	})
+}
+
+// LogUpdate writes an "update" event.
+func (j *JSONUI) LogUpdate(iterations int, objective float64) {
+	j.write("update", nil, map[string]interface{}{
+		"iterations": iterations,
+		"objective":  objective,
+	})
+}
+
+// LogReductionRatio writes a "reduction_ratio" event.
+func (j *JSONUI) LogReductionRatio(ratio float64) {
+	j.write("reduction_ratio", nil, map[string]interface{}{
+		"ratio": ratio,
+	})
+}
+
+// LogEpochEnd writes an "epoch_end" event.
+func (j *JSONUI) LogEpochEnd(epoch int) {
+	j.write("epoch_end", nil, map[string]interface{}{
+		"epoch": epoch,
+	})
+}
+
+// LogValidation writes a "validation" event.
+func (j *JSONUI) LogValidation(epoch int, cost float64) {
+	j.write("validation", nil, map[string]interface{}{
+		"epoch": epoch,
+		"cost":  cost,
+	})
+}
+
+// LogTiming writes a "timing" event, with the duration
+// given in seconds.
+func (j *JSONUI) LogTiming(name string, duration time.Duration) {
+	j.write("timing", nil, map[string]interface{}{
+		"name":    name,
+		"seconds": duration.Seconds(),
+	})
+}
+
+// ShouldStop returns true once Stop has been called.
+func (j *JSONUI) ShouldStop() bool {
+	return atomic.LoadUint32(&j.killFlag) != 0
+}
+
+// Stop tells training to stop at the next opportunity.
+func (j *JSONUI) Stop() {
+	atomic.StoreUint32(&j.killFlag, 1)
+}
+
+// Err returns the first error encountered while writing
+// events, if any.
+// After an error, no more events are written.
+func (j *JSONUI) Err() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.err
+}
+
+func (j *JSONUI) write(event string, update func(), fields map[string]interface{}) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if update != nil {
+		update()
+	}
+	j.step++
+	if j.err != nil {
+		return
+	}
+
+	for key, value := range fields {
+		if x, ok := value.(float64); ok && (math.IsNaN(x) || math.IsInf(x, 0)) {
+			fields[key] = nil
+		}
+	}
+	fields["event"] = event
+	fields["time"] = time.Now().Format(time.RFC3339Nano)
+	fields["step"] = j.step
+	fields["batch_step"] = j.batchStep
+	fields["cg_step"] = j.cgStep
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		j.err = err
+		return
+	}
+	data = append(data, '\n')
+	if _, err := j.writer.Write(data); err != nil {
+		j.err = err
+	}
+}
@@ -0,0 +1,62 @@
+package hessfree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestJSONUI(t *testing.T) {
+	var buf bytes.Buffer
+	ui := NewJSONUI(&buf)
+	ui.LogNewMiniBatch(0, 0)
+	ui.LogCGStart(1, 2)
+	ui.LogCGIteration(0.5, 0.75)
+	ui.LogCGIteration(0.25, math.NaN())
+	ui.Log("Test", "hello")
+	ui.LogDamping(0.3, 1.5)
+	ui.LogNewMiniBatch(0, 1)
+	if err := ui.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		event     string
+		batchStep float64
+		cgStep    float64
+	}{
+		{"mini_batch", 1, 0},
+		{"cg_start", 1, 0},
+		{"cg_iteration", 1, 1},
+		{"cg_iteration", 1, 2},
+		{"log", 1, 2},
+		{"damping", 1, 2},
+		{"mini_batch", 2, 0},
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	var i int
+	for scanner.Scan() {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(expected) {
+			t.Fatal("too many events")
+		}
+		exp := expected[i]
+		if obj["event"] != exp.event || obj["step"] != float64(i+1) ||
+			obj["batch_step"] != exp.batchStep || obj["cg_step"] != exp.cgStep {
+			t.Errorf("unexpected event %d: %v", i, obj)
+		}
+		if _, ok := obj["time"].(string); !ok {
+			t.Errorf("missing time for event %d", i)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Error("expected", len(expected), "events but got", i)
+	}
+}
@@ -0,0 +1,176 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+const defaultLanczosIterations = 20
+
+// A LanczosResult stores the output of the Lanczos
+// algorithm on a curvature matrix A.
+//
+// The algorithm builds an orthonormal basis V for a Krylov
+// subspace and a tridiagonal matrix T = V^T*A*V.
+// The eigenvalues of T (the Ritz values) approximate the
+// extreme eigenvalues of A, which is useful for tracking
+// the conditioning of A or choosing a DampingCoeff.
+type LanczosResult struct {
+	Layout *ParamLayout
+
+	// Basis contains the orthonormal Lanczos vectors.
+	Basis []linalg.Vector
+
+	// Alpha is the diagonal of T, and Beta is the part of
+	// the off-diagonal above (and below) the diagonal.
+	Alpha linalg.Vector
+	Beta  linalg.Vector
+
+	// RitzValues are the eigenvalues of T in ascending
+	// order.
+	RitzValues linalg.Vector
+
+	// RitzVectors contains the approximate eigenvector for
+	// each of the Ritz values.
+	RitzVectors []ConstParamDelta
+
+	// eigenvectors of T, stored as columns.
+	tridiagVectors *linalg.Matrix
+}
+
+// Lanczos runs the Lanczos algorithm with full
+// reorthogonalization on the curvature matrix of a
+// QuadObjective, using QuadHessian for matrix-vector
+// products.
+//
+// The start vector may be nil, in which case a random
+// vector is used.
+// If iterations is 0, a reasonable default is used.
+// The algorithm stops early if it finds an invariant
+// subspace.
+func Lanczos(obj QuadObjective, l *ParamLayout, s sgd.SampleSet, start ConstParamDelta,
+	iterations int) *LanczosResult {
+	res, _ := lanczos(obj, l, s, start, iterations, nil)
+	return res
+}
+
+// lanczos is like Lanczos, but it calls stop (if it is
+// non-nil) before every iteration.
+// If stop returns true, this returns (nil, true).
+func lanczos(obj QuadObjective, l *ParamLayout, s sgd.SampleSet, start ConstParamDelta,
+	iterations int, stop func() bool) (*LanczosResult, bool) {
+	if iterations == 0 {
+		iterations = defaultLanczosIterations
+	}
+	if iterations > l.Len() {
+		iterations = l.Len()
+	}
+
+	var vec linalg.Vector
+	if start != nil {
+		vec = l.Flatten(start)
+	} else {
+		vec = make(linalg.Vector, l.Len())
+		for i := range vec {
+			vec[i] = rand.NormFloat64()
+		}
+	}
+	res := &LanczosResult{Layout: l}
+	mag := vec.Mag()
+	if mag == 0 {
+		return res, false
+	}
+	vec.Scale(1 / mag)
+
+	zero := l.Unflatten(make(linalg.Vector, l.Len()))
+	for i := 0; i < iterations; i++ {
+		if stop != nil && stop() {
+			return nil, true
+		}
+		res.Basis = append(res.Basis, vec)
+		product, _ := obj.QuadHessian(l.Unflatten(vec), zero, s)
+		w := l.Flatten(product)
+
+		alpha := w.Dot(vec)
+		res.Alpha = append(res.Alpha, alpha)
+
+		// Two passes of Gram-Schmidt keep the basis
+		// orthogonal in floating point.
+		for pass := 0; pass < 2; pass++ {
+			for _, basisVec := range res.Basis {
+				w.Add(basisVec.Copy().Scale(-w.Dot(basisVec)))
+			}
+		}
+
+		if i+1 == iterations {
+			break
+		}
+		beta := w.Mag()
+		if beta <= 1e-10*math.Max(math.Abs(alpha), 1) {
+			break
+		}
+		res.Beta = append(res.Beta, beta)
+		vec = w.Scale(1 / beta)
+	}
+
+	res.computeRitz()
+	return res, false
+}
+
+// Tridiagonal returns the tridiagonal matrix T.
+func (l *LanczosResult) Tridiagonal() *linalg.Matrix {
+	n := len(l.Alpha)
+	res := linalg.NewMatrix(n, n)
+	for i, x := range l.Alpha {
+		res.Set(i, i, x)
+	}
+	for i, x := range l.Beta {
+		res.Set(i, i+1, x)
+		res.Set(i+1, i, x)
+	}
+	return res
+}
+
+// MinEigenvalue returns the smallest Ritz value.
+// It returns NaN if there are no Ritz values, which
+// happens when the start vector or the layout is empty.
+func (l *LanczosResult) MinEigenvalue() float64 {
+	if len(l.RitzValues) == 0 {
+		return math.NaN()
+	}
+	return l.RitzValues[0]
+}
+
+// MaxEigenvalue returns the largest Ritz value.
+// Like MinEigenvalue, it returns NaN if there are no Ritz
+// values.
+func (l *LanczosResult) MaxEigenvalue() float64 {
+	if len(l.RitzValues) == 0 {
+		return math.NaN()
+	}
+	return l.RitzValues[len(l.RitzValues)-1]
+}
+
+// ConditionNumber estimates the condition number of the
+// curvature matrix using the Ritz values.
+// It returns NaN if there are no Ritz values.
+func (l *LanczosResult) ConditionNumber() float64 {
+	return conditionNumber(l.RitzValues)
+}
+
+func (l *LanczosResult) computeRitz() {
+	if len(l.Alpha) == 0 {
+		return
+	}
+	l.RitzValues, l.tridiagVectors = symmetricEigen(l.Tridiagonal())
+	for i := range l.RitzValues {
+		vec := make(linalg.Vector, l.Layout.Len())
+		for j, basisVec := range l.Basis {
+			vec.Add(basisVec.Copy().Scale(l.tridiagVectors.Get(j, i)))
+		}
+		l.RitzVectors = append(l.RitzVectors, l.Layout.Unflatten(vec))
+	}
+}
@@ -0,0 +1,260 @@
+package hessfree
+
+import (
+	"math"
+	"time"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+const (
+	defaultLBFGSMemory        = 10
+	defaultLBFGSMaxLineSearch = 20
+	lbfgsArmijoConstant       = 1e-4
+	lbfgsLineSearchDecay      = 0.5
+)
+
+// An LBFGSTrainer runs L-BFGS on a Learner, so that
+// Hessian Free can be compared to a quasi-Newton method
+// on the same model and data.
+// It has the same basic fields as Trainer, so that one can
+// be swapped for the other.
+//
+// For every mini-batch, the gradient is the QuadGrad of a
+// fresh Objective at a delta of zero, and the step size is
+// chosen with a backtracking line search on the true
+// objective.
+// Curvature pairs are computed on a single mini-batch, as
+// in Schraudolph et al. (2007), so that the gradient noise
+// between mini-batches does not corrupt the history.
+// As a result, every mini-batch after the first costs one
+// extra gradient evaluation, on the previous mini-batch.
+//
+// The Learner should not add its own damping, since the
+// deltas passed to Adjust are not minima of the quadratic
+// approximation.
+type LBFGSTrainer struct {
+	// Learner is trained using L-BFGS.
+	Learner Learner
+
+	// Samples contains all of the training samples.
+	Samples sgd.SampleSet
+
+	// BatchSize is the size of mini-batches.
+	BatchSize int
+
+	// UI is the means by which the trainer communicates with
+	// the user.
+	// Line search trials are logged like CG iterations.
+	UI UI
+
+	// Validation, if non-nil, is a set of samples whose
+	// cost is computed and logged after every epoch, as
+	// with Trainer.Validation.
+	Validation sgd.SampleSet
+
+	// Memory is the number of past updates used to
+	// approximate the inverse Hessian.
+	// If this is 0, a reasonable default is used.
+	Memory int
+
+	// MaxLineSearch is the maximum number of step sizes to
+	// try for each mini-batch.
+	// If this is 0, a reasonable default is used.
+	MaxLineSearch int
+}
+
+func (l *LBFGSTrainer) Train() {
+	events, _ := l.UI.(EventUI)
+
+	var history lbfgsHistory
+	var lastStep ConstParamDelta
+	var lastSubset sgd.SampleSet
+	var lastGrad ConstParamDelta
+
+	var epoch int
+	for {
+		shuffled := l.Samples.Copy()
+		sgd.ShuffleSampleSet(shuffled)
+
+		var miniBatch int
+		for i := 0; i < shuffled.Len(); i += l.BatchSize {
+			bs := l.BatchSize
+			if bs > shuffled.Len()-i {
+				bs = shuffled.Len() - i
+			}
+			subset := shuffled.Subset(i, i+bs)
+			if l.UI.ShouldStop() {
+				return
+			}
+			l.UI.LogNewMiniBatch(epoch, miniBatch)
+			batchStart := time.Now()
+
+			obj := l.Learner.MakeObjective()
+			zero := l.zeroDelta()
+			if lastStep != nil {
+				newGrad := obj.QuadGrad(zero, lastSubset)
+				diff := newGrad.Clone()
+				diff.Axpy(-1, lastGrad)
+				history.Add(lastStep, diff, l.memory())
+			}
+
+			grad := obj.QuadGrad(zero, subset).Clone()
+			step, value, iters, stopped := l.lineSearch(obj, subset, grad,
+				history.Direction(grad))
+			if stopped {
+				return
+			}
+			if events != nil {
+				events.LogTiming(TimingLineSearch, time.Since(batchStart))
+				events.LogUpdate(iters, value)
+			}
+
+			if step == nil {
+				l.UI.Log("LBFGS", "line search failed; clearing history")
+				history = lbfgsHistory{}
+				lastStep = nil
+			} else {
+				adjustStart := time.Now()
+				l.Learner.Adjust(step, step, subset)
+				if events != nil {
+					events.LogTiming(TimingAdjust, time.Since(adjustStart))
+				}
+				lastStep = step.Clone()
+				lastSubset = subset
+				lastGrad = grad
+			}
+			if events != nil {
+				events.LogTiming(TimingMiniBatch, time.Since(batchStart))
+			}
+
+			miniBatch++
+		}
+
+		if events != nil {
+			events.LogEpochEnd(epoch)
+		}
+		if l.Validation != nil {
+			logValidation(l.Learner, l.UI, l.Validation, epoch)
+		}
+
+		epoch++
+	}
+}
+
+// lineSearch shrinks the direction until it satisfies
+// the Armijo condition on the true objective.
+// It returns a nil step if no acceptable step was found,
+// and stopped is true if the UI asked it to stop.
+func (l *LBFGSTrainer) lineSearch(obj Objective, s sgd.SampleSet,
+	grad, dir ConstParamDelta) (step ConstParamDelta, value float64, iters int,
+	stopped bool) {
+	startValue := obj.Objective(ConstParamDelta{}, s)
+	l.UI.LogCGStart(startValue, startValue)
+
+	slope := grad.Dot(dir)
+	if slope >= 0 {
+		return nil, startValue, 0, false
+	}
+
+	events, _ := l.UI.(EventUI)
+	stepSize := 1.0
+	for iters < l.maxLineSearch() {
+		iters++
+		step = dir.Clone()
+		step.Scale(stepSize)
+		value = obj.Objective(step, s)
+		l.UI.LogCGIteration(stepSize, value)
+		if value <= startValue+lbfgsArmijoConstant*stepSize*slope {
+			return step, value, iters, false
+		}
+		if events != nil {
+			events.LogBacktrack(iters, value)
+		}
+		if l.UI.ShouldStop() {
+			return nil, startValue, iters, true
+		}
+		stepSize *= lbfgsLineSearchDecay
+	}
+	return nil, startValue, iters, false
+}
+
+func (l *LBFGSTrainer) zeroDelta() ConstParamDelta {
+	delta := ConstParamDelta{}
+	for _, param := range l.Learner.Parameters() {
+		delta[param] = make(linalg.Vector, len(param.Vector))
+	}
+	return delta
+}
+
+func (l *LBFGSTrainer) memory() int {
+	if l.Memory == 0 {
+		return defaultLBFGSMemory
+	}
+	return l.Memory
+}
+
+func (l *LBFGSTrainer) maxLineSearch() int {
+	if l.MaxLineSearch == 0 {
+		return defaultLBFGSMaxLineSearch
+	}
+	return l.MaxLineSearch
+}
+
+// lbfgsHistory stores the most recent parameter steps and
+// gradient differences, oldest first.
+type lbfgsHistory struct {
+	steps     []ConstParamDelta
+	gradDiffs []ConstParamDelta
+	dots      []float64
+}
+
+// Add adds a pair to the history, dropping the oldest
+// pair if there are more than memory pairs.
+// Pairs with non-positive curvature are ignored, since
+// they would make the inverse Hessian indefinite.
+func (l *lbfgsHistory) Add(step, gradDiff ConstParamDelta, memory int) {
+	dot := step.Dot(gradDiff)
+	if dot <= 0 || math.IsNaN(dot) {
+		return
+	}
+	l.steps = append(l.steps, step)
+	l.gradDiffs = append(l.gradDiffs, gradDiff)
+	l.dots = append(l.dots, dot)
+	if len(l.steps) > memory {
+		l.steps = l.steps[1:]
+		l.gradDiffs = l.gradDiffs[1:]
+		l.dots = l.dots[1:]
+	}
+}
+
+// Direction computes the search direction -H*grad using
+// the two-loop recursion.
+// With an empty history, this is the negative gradient,
+// shortened to unit length if it is longer.
+func (l *lbfgsHistory) Direction(grad ConstParamDelta) ConstParamDelta {
+	res := grad.Clone()
+	if len(l.steps) == 0 {
+		res.Scale(-1 / math.Max(1, res.Norm()))
+		return res
+	}
+
+	alphas := make([]float64, len(l.steps))
+	for i := len(l.steps) - 1; i >= 0; i-- {
+		alphas[i] = l.steps[i].Dot(res) / l.dots[i]
+		res.Axpy(-alphas[i], l.gradDiffs[i])
+	}
+
+	last := len(l.steps) - 1
+	lastDiff := l.gradDiffs[last]
+	res.Scale(l.dots[last] / lastDiff.Dot(lastDiff))
+
+	for i, step := range l.steps {
+		beta := l.gradDiffs[i].Dot(res) / l.dots[i]
+		res.Axpy(alphas[i]-beta, step)
+	}
+
+	res.Scale(-1)
+	return res
+}
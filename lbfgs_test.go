@@ -0,0 +1,117 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestLBFGSHistorySecant(t *testing.T) {
+	params := []*autofunc.Variable{
+		&autofunc.Variable{Vector: make(linalg.Vector, 3)},
+		&autofunc.Variable{Vector: make(linalg.Vector, 2)},
+	}
+	randomDelta := func() ConstParamDelta {
+		res := ConstParamDelta{}
+		for _, p := range params {
+			res[p] = make(linalg.Vector, len(p.Vector))
+			for i := range res[p] {
+				res[p][i] = rand.NormFloat64()
+			}
+		}
+		return res
+	}
+
+	var history lbfgsHistory
+	var step, diff ConstParamDelta
+	for i := 0; i < 4; i++ {
+		step = randomDelta()
+		diff = step.Clone()
+		diff.Axpy(0.1, randomDelta())
+		history.Add(step, diff, 3)
+	}
+	if len(history.steps) != 3 {
+		t.Fatal("expected 3 pairs but got", len(history.steps))
+	}
+
+	// The inverse Hessian approximation maps the newest
+	// gradient difference to the newest step.
+	dir := history.Direction(diff)
+	for _, p := range params {
+		for i, x := range dir[p] {
+			if math.Abs(x+step[p][i]) > 1e-8 {
+				t.Errorf("entry %d: expected %f but got %f", i, -step[p][i], x)
+			}
+		}
+	}
+}
+
+func TestLBFGSTrainer(t *testing.T) {
+	dampingLearner, samples := trainerTestLearner()
+	learner := dampingLearner.WrappedLearner
+	initial := learner.MakeObjective().Objective(ConstParamDelta{}, samples)
+
+	ui := &recordingUI{stopEpoch: 3}
+	trainer := &LBFGSTrainer{
+		Learner:    learner,
+		Samples:    samples,
+		BatchSize:  10,
+		UI:         ui,
+		Validation: samples.Subset(0, 5),
+	}
+	trainer.Train()
+
+	final := learner.MakeObjective().Objective(ConstParamDelta{}, samples)
+	if final >= initial {
+		t.Error("objective did not decrease:", initial, "to", final)
+	}
+	if ui.updates != 6 {
+		t.Error("expected 6 updates but got", ui.updates)
+	}
+	if ui.validations != 3 {
+		t.Error("expected 3 validations but got", ui.validations)
+	}
+	if ui.timings[TimingLineSearch] != 6 {
+		t.Error("expected 6 line search timings but got", ui.timings[TimingLineSearch])
+	}
+}
+
+func TestLBFGSLineSearchStop(t *testing.T) {
+	param := &autofunc.Variable{Vector: []float64{0}}
+	obj := &saddleTestObjective{
+		Param:     param,
+		Curvature: linalg.Vector{1},
+		Gradient:  linalg.Vector{1},
+	}
+	ui := &lineSearchStopUI{}
+	trainer := &LBFGSTrainer{
+		Learner: &paramsLearner{[]*autofunc.Variable{param}},
+		UI:      ui,
+	}
+
+	// The objective increases along the direction, so the
+	// line search would never succeed.
+	dir := ConstParamDelta{param: linalg.Vector{1}}
+	grad := ConstParamDelta{param: linalg.Vector{-1}}
+	step, _, iters, stopped := trainer.lineSearch(obj, sgd.SliceSampleSet{nil}, grad, dir)
+	if !stopped {
+		t.Error("expected line search to stop")
+	}
+	if step != nil || iters != 1 {
+		t.Error("expected no step after 1 iteration but got", step, iters)
+	}
+}
+
+// lineSearchStopUI asks to stop after the first line
+// search trial.
+type lineSearchStopUI struct {
+	recordingUI
+}
+
+func (l *lineSearchStopUI) ShouldStop() bool {
+	return l.cgIterations > 0
+}
@@ -2,6 +2,7 @@ package hessfree
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/sgd"
@@ -11,6 +12,7 @@ import (
 const (
 	defaultDampingCoeff       = 1
 	defaultDampingChangeRatio = 1.5
+	defaultMinDiagonal        = 1e-3
 )
 
 // A Learner has learnable parameters and can create
@@ -45,6 +47,29 @@ type Learner interface {
 	Adjust(adjustment, quadMin ConstParamDelta, s sgd.SampleSet)
 }
 
+// An Evaluator is a Learner which can compute its true
+// cost on a sample set without creating an Objective.
+//
+// Unlike MakeObjective, Evaluate has no side effects, so
+// it can be used outside of the MakeObjective and Adjust
+// cycle (e.g. for validation).
+type Evaluator interface {
+	Learner
+
+	// Evaluate computes the true cost of the samples for
+	// the current parameters.
+	Evaluate(s sgd.SampleSet) float64
+}
+
+// evaluate computes the true cost of a learner on the
+// samples, using Evaluate if the learner is an Evaluator.
+func evaluate(l Learner, s sgd.SampleSet) float64 {
+	if e, ok := l.(Evaluator); ok {
+		return e.Evaluate(s)
+	}
+	return l.MakeObjective().Objective(ConstParamDelta{}, s)
+}
+
 // A NeuralNetLearner is a Learner which wraps a neural net
 // and creates concurrent Gauss-Newton objectives.
 type NeuralNetLearner struct {
@@ -56,6 +81,12 @@ type NeuralNetLearner struct {
 	// Parameters for the ConcurrentObjectives.
 	MaxSubBatch    int
 	MaxConcurrency int
+
+	// Normalize specifies that the objectives should be
+	// mean costs per sample rather than total costs.
+	// Learners which wrap this one, like DampingLearner,
+	// detect this and scale their own terms to match.
+	Normalize bool
 }
 
 // Parameters returns the parameters of n.Layers.
@@ -63,6 +94,11 @@ func (n *NeuralNetLearner) Parameters() []*autofunc.Variable {
 	return n.Layers.Parameters()
 }
 
+// Normalized returns n.Normalize.
+func (n *NeuralNetLearner) Normalized() bool {
+	return n.Normalize
+}
+
 // MakeObjective creates a ConcurrentObjective which
 // wraps a Gauss-Newton objective.
 func (n *NeuralNetLearner) MakeObjective() Objective {
@@ -75,9 +111,12 @@ func (n *NeuralNetLearner) MakeObjective() Objective {
 			Layers: n.Layers.BatchLearner(),
 			Output: output,
 			Cost:   n.Cost,
+
+			CacheBatchState: true,
 		},
 		MaxConcurrency: n.MaxConcurrency,
 		MaxSubBatch:    n.MaxSubBatch,
+		Normalize:      n.Normalize,
 	}
 }
 
@@ -102,6 +141,10 @@ type DampingLearner struct {
 	// the number of samples in each sample set, since it
 	// is assumed that the total cost is the sum of the
 	// costs for each sample.
+	// For WeightedSamples, the total weight of the samples
+	// is used instead of the number of samples.
+	// If the wrapped learner's objectives are normalized
+	// (see Normalizer), the coefficient is not multiplied.
 	DampingCoeff float64
 
 	// UseQuadMin can be used to specify that the minimum of
@@ -115,25 +158,99 @@ type DampingLearner struct {
 	// If this is 1, the damping will never change.
 	ChangeRatio float64
 
+	// Groups optionally assigns relative damping scales to
+	// sets of parameters.
+	// Parameters which are not in any group are damped with
+	// a relative scale of 1.
+	// A group may contain a single variable, making it
+	// possible to scale the damping of each variable.
+	Groups []*DampingGroup
+
+	// Diagonal, if non-nil, is used to compute a diagonal
+	// matrix D for each mini-batch, making the damping term
+	// proportional to delta^T D delta instead of the squared
+	// magnitude of delta.
+	Diagonal DampingDiagonal
+
+	// MinDiagonal is the minimum value for entries of the
+	// damping diagonal, expressed as a fraction of the mean
+	// diagonal entry.
+	// If this is 0, a reasonable default is used.
+	MinDiagonal float64
+
 	// If UI is set, it will be used to log damping updates.
 	UI UI
 
 	lastObjective Objective
 }
 
+// A DampingGroup is a set of parameters whose damping
+// coefficient is scaled relative to the DampingCoeff
+// of a DampingLearner.
+type DampingGroup struct {
+	// Name identifies the group in log messages.
+	Name string
+
+	// Params are the variables in the group.
+	Params []*autofunc.Variable
+
+	// Scale is multiplied by the learner's DampingCoeff to
+	// get the damping coefficient for the group.
+	// If Scale is 0, it will be set to 1 during the first
+	// training iteration.
+	Scale float64
+
+	// Adaptive specifies that Scale should be adjusted
+	// independently of the global DampingCoeff, using the
+	// heuristic from Martens (2010) on the part of each
+	// update which belongs to this group.
+	Adaptive bool
+}
+
 func (d *DampingLearner) Parameters() []*autofunc.Variable {
 	return d.WrappedLearner.Parameters()
 }
 
+// Normalized checks if the wrapped learner is normalized.
+func (d *DampingLearner) Normalized() bool {
+	return isNormalized(d.WrappedLearner)
+}
+
 func (d *DampingLearner) MakeObjective() Objective {
 	if d.DampingCoeff == 0 {
 		d.DampingCoeff = defaultDampingCoeff
 	}
 	d.lastObjective = d.WrappedLearner.MakeObjective()
-	return &dampedObjective{
+	res := &dampedObjective{
 		WrappedObjective: d.lastObjective,
 		Coeff:            d.DampingCoeff,
+		Scales:           d.groupScales(),
 	}
+	if d.Diagonal != nil {
+		estimator := d.Diagonal
+		params := d.Parameters()
+		objective := d.lastObjective
+		if isNormalized(objective) {
+			// Estimators expect objectives which sum over samples.
+			objective = &summedObjective{objective}
+		}
+		minScale := d.MinDiagonal
+		if minScale == 0 {
+			minScale = defaultMinDiagonal
+		}
+		res.DiagonalFunc = func(s sgd.SampleSet) ConstParamDelta {
+			diag := estimator.Diagonal(params, objective, s)
+			clampDiagonal(diag, minScale)
+			return diag
+		}
+	}
+	return res
+}
+
+// Evaluate evaluates the wrapped learner without
+// touching the damping state.
+func (d *DampingLearner) Evaluate(s sgd.SampleSet) float64 {
+	return evaluate(d.WrappedLearner, s)
 }
 
 func (d *DampingLearner) Adjust(delta, quadMin ConstParamDelta, s sgd.SampleSet) {
@@ -147,48 +264,144 @@ func (d *DampingLearner) Adjust(delta, quadMin ConstParamDelta, s sgd.SampleSet)
 		return
 	}
 
-	var trust float64
+	trustDelta := delta
+	if d.UseQuadMin {
+		trustDelta = quadMin
+	}
 
 	centerVal := d.lastObjective.Objective(ConstParamDelta{}, s)
-	if d.UseQuadMin {
-		quadOffset := d.lastObjective.Quad(quadMin, s)
-		realOffset := d.lastObjective.Objective(quadMin, s)
-		trust = (realOffset - centerVal) / (quadOffset - centerVal)
-	} else {
-		quadOffset := d.lastObjective.Quad(delta, s)
-		realOffset := d.lastObjective.Objective(delta, s)
-		trust = (realOffset - centerVal) / (quadOffset - centerVal)
+	trust := d.trustQuotient(trustDelta, centerVal, s)
+
+	groupTrusts := make([]float64, len(d.Groups))
+	for i, group := range d.Groups {
+		if group.Adaptive {
+			groupDelta := restrictDelta(trustDelta, group.Params)
+			groupTrusts[i] = d.trustQuotient(groupDelta, centerVal, s)
+		}
 	}
 
 	d.WrappedLearner.Adjust(delta, quadMin, s)
 
-	d.UI.Log("DampingLearner", fmt.Sprintf("trust quotient is %f", trust))
+	d.log(fmt.Sprintf("trust quotient is %f", trust))
+	if events, ok := d.UI.(EventUI); ok {
+		events.LogReductionRatio(trust)
+	}
 	if trust < 0.25 {
 		d.DampingCoeff *= changeCoeff
-		if d.UI != nil {
-			d.UI.Log("DampingLearner", fmt.Sprintf("raised damping to %f",
-				d.DampingCoeff))
-		}
+		d.log(fmt.Sprintf("raised damping to %f", d.DampingCoeff))
 	} else if trust > 0.75 {
 		d.DampingCoeff /= changeCoeff
-		if d.UI != nil {
-			d.UI.Log("DampingLearner", fmt.Sprintf("lowered damping to %f",
-				d.DampingCoeff))
+		d.log(fmt.Sprintf("lowered damping to %f", d.DampingCoeff))
+	}
+	if logger, ok := d.UI.(DampingLogger); ok {
+		logger.LogDamping(trust, d.DampingCoeff)
+	}
+
+	for i, group := range d.Groups {
+		if !group.Adaptive {
+			continue
+		}
+		groupTrust := groupTrusts[i]
+		d.log(fmt.Sprintf("trust quotient for %s is %f", group.Name, groupTrust))
+		if groupTrust < 0.25 {
+			group.Scale *= changeCoeff
+			d.log(fmt.Sprintf("raised damping scale for %s to %f", group.Name,
+				group.Scale))
+		} else if groupTrust > 0.75 {
+			group.Scale /= changeCoeff
+			d.log(fmt.Sprintf("lowered damping scale for %s to %f", group.Name,
+				group.Scale))
+		}
+	}
+}
+
+// trustQuotient computes the ratio between the actual
+// reduction in the objective and the reduction predicted
+// by the quadratic approximation.
+func (d *DampingLearner) trustQuotient(delta ConstParamDelta, centerVal float64,
+	s sgd.SampleSet) float64 {
+	quadOffset := d.lastObjective.Quad(delta, s)
+	realOffset := d.lastObjective.Objective(delta, s)
+	return (realOffset - centerVal) / (quadOffset - centerVal)
+}
+
+// groupScales creates a mapping from variables to their
+// relative damping scales, or returns nil if there are no
+// damping groups.
+func (d *DampingLearner) groupScales() map[*autofunc.Variable]float64 {
+	if len(d.Groups) == 0 {
+		return nil
+	}
+	res := map[*autofunc.Variable]float64{}
+	for _, group := range d.Groups {
+		if group.Scale == 0 {
+			group.Scale = 1
+		}
+		for _, param := range group.Params {
+			res[param] = group.Scale
+		}
+	}
+	return res
+}
+
+func (d *DampingLearner) log(message string) {
+	if d.UI != nil {
+		d.UI.Log("DampingLearner", message)
+	}
+}
+
+// restrictDelta creates a copy of delta in which every
+// entry outside of the given parameters is zero.
+func restrictDelta(delta ConstParamDelta, params []*autofunc.Variable) ConstParamDelta {
+	res := delta.CloneShape()
+	for _, param := range params {
+		if vec, ok := delta[param]; ok {
+			copy(res[param], vec)
 		}
 	}
+	return res
 }
 
 type dampedObjective struct {
 	WrappedObjective Objective
 	Coeff            float64
+
+	// Scales optionally maps variables to relative damping
+	// coefficients.
+	// Variables which are not in the map use a scale of 1.
+	Scales map[*autofunc.Variable]float64
+
+	// DiagonalFunc, if non-nil, computes per-entry damping
+	// scales for a sample set.
+	// It is called once for each sample set the objective
+	// is used with.
+	DiagonalFunc func(s sgd.SampleSet) ConstParamDelta
+
+	diagLock  sync.Mutex
+	diagonals map[sampleSetKey]*dampingDiagonalEntry
+}
+
+// dampingDiagonalEntry stores the damping diagonal for
+// one sample set.
+type dampingDiagonalEntry struct {
+	once     sync.Once
+	samples  sgd.SampleSet
+	diagonal ConstParamDelta
 }
 
 func (d *dampedObjective) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
 	res := d.WrappedObjective.Quad(delta, s)
-	scaler := float64(s.Len()) * d.Coeff
-	for _, subDelta := range delta {
-		for _, x := range subDelta {
-			res += scaler * x * x
+	diagonal := d.computeDiagonal(s)
+	weight := d.sampleScale(s)
+	for variable, subDelta := range delta {
+		scaler := d.coeff(variable, weight)
+		diagVec := diagonal[variable]
+		for i, x := range subDelta {
+			if diagVec != nil {
+				res += scaler * diagVec[i] * x * x
+			} else {
+				res += scaler * x * x
+			}
 		}
 	}
 	return res
@@ -196,12 +409,19 @@ func (d *dampedObjective) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
 
 func (d *dampedObjective) QuadGrad(delta ConstParamDelta, s sgd.SampleSet) ConstParamDelta {
 	res := d.WrappedObjective.QuadGrad(delta, s)
+	diagonal := d.computeDiagonal(s)
+	weight := d.sampleScale(s)
 
-	scaler := float64(2*s.Len()) * d.Coeff
 	for variable, subDelta := range delta {
+		scaler := 2 * d.coeff(variable, weight)
+		diagVec := diagonal[variable]
 		resVec := res[variable]
 		for i, x := range subDelta {
-			resVec[i] += scaler * x
+			if diagVec != nil {
+				resVec[i] += scaler * diagVec[i] * x
+			} else {
+				resVec[i] += scaler * x
+			}
 		}
 	}
 
@@ -211,18 +431,30 @@ func (d *dampedObjective) QuadGrad(delta ConstParamDelta, s sgd.SampleSet) Const
 func (d *dampedObjective) QuadHessian(delta, x ConstParamDelta, s sgd.SampleSet) (ConstParamDelta,
 	float64) {
 	res, outVal := d.WrappedObjective.QuadHessian(delta, x, s)
+	diagonal := d.computeDiagonal(s)
+	weight := d.sampleScale(s)
 
-	scaler := float64(s.Len()) * d.Coeff
-	rScaler := 2 * scaler
 	for variable, subDelta := range delta {
+		rScaler := 2 * d.coeff(variable, weight)
+		diagVec := diagonal[variable]
 		resVec := res[variable]
 		for i, x := range subDelta {
-			resVec[i] += rScaler * x
+			if diagVec != nil {
+				resVec[i] += rScaler * diagVec[i] * x
+			} else {
+				resVec[i] += rScaler * x
+			}
 		}
 	}
-	for _, subDelta := range x {
-		for _, y := range subDelta {
-			outVal += scaler * y * y
+	for variable, subDelta := range x {
+		scaler := d.coeff(variable, weight)
+		diagVec := diagonal[variable]
+		for i, y := range subDelta {
+			if diagVec != nil {
+				outVal += scaler * diagVec[i] * y * y
+			} else {
+				outVal += scaler * y * y
+			}
 		}
 	}
 
@@ -232,3 +464,104 @@ func (d *dampedObjective) QuadHessian(delta, x ConstParamDelta, s sgd.SampleSet)
 func (d *dampedObjective) Objective(delta ConstParamDelta, s sgd.SampleSet) float64 {
 	return d.WrappedObjective.Objective(delta, s)
 }
+
+// Normalized checks if the wrapped objective is
+// normalized, in which case the damping does not scale
+// with the number of samples.
+func (d *dampedObjective) Normalized() bool {
+	return isNormalized(d.WrappedObjective)
+}
+
+// sampleScale returns the factor by which the damping is
+// scaled for the sample set.
+func (d *dampedObjective) sampleScale(s sgd.SampleSet) float64 {
+	return sampleScale(d.Normalized(), s)
+}
+
+// coeff returns the damping coefficient for the squared
+// entries of the given variable's delta, given the total
+// weight of the samples.
+func (d *dampedObjective) coeff(v *autofunc.Variable, weight float64) float64 {
+	res := weight * d.Coeff
+	if scale, ok := d.Scales[v]; ok {
+		res *= scale
+	}
+	return res
+}
+
+// computeDiagonal returns the damping diagonal for the
+// sample set, computing it if necessary.
+// The result is nil if no DiagonalFunc is set.
+//
+// Diagonals are cached for the lifetime of the objective,
+// which is usually a single mini-batch.
+func (d *dampedObjective) computeDiagonal(s sgd.SampleSet) ConstParamDelta {
+	if d.DiagonalFunc == nil {
+		return nil
+	}
+	key, ok := newSampleSetKey(s)
+	if !ok {
+		return d.DiagonalFunc(s)
+	}
+
+	d.diagLock.Lock()
+	if d.diagonals == nil {
+		d.diagonals = map[sampleSetKey]*dampingDiagonalEntry{}
+	}
+	entry, ok := d.diagonals[key]
+	if !ok {
+		entry = &dampingDiagonalEntry{samples: s}
+		d.diagonals[key] = entry
+	}
+	d.diagLock.Unlock()
+
+	entry.once.Do(func() {
+		entry.diagonal = d.DiagonalFunc(s)
+	})
+	return entry.diagonal
+}
+
+// summedObjective turns an objective which computes means
+// over samples into one which computes sums.
+type summedObjective struct {
+	Wrapped Objective
+}
+
+func (s *summedObjective) Quad(delta ConstParamDelta, samples sgd.SampleSet) float64 {
+	return totalWeight(samples) * s.Wrapped.Quad(delta, samples)
+}
+
+func (s *summedObjective) QuadGrad(delta ConstParamDelta,
+	samples sgd.SampleSet) ConstParamDelta {
+	res := s.Wrapped.QuadGrad(delta, samples)
+	res.Scale(totalWeight(samples))
+	return res
+}
+
+func (s *summedObjective) QuadHessian(delta, x ConstParamDelta,
+	samples sgd.SampleSet) (ConstParamDelta, float64) {
+	res, val := s.Wrapped.QuadHessian(delta, x, samples)
+	weight := totalWeight(samples)
+	res.Scale(weight)
+	return res, val * weight
+}
+
+func (s *summedObjective) Objective(delta ConstParamDelta, samples sgd.SampleSet) float64 {
+	return totalWeight(samples) * s.Wrapped.Objective(delta, samples)
+}
+
+func (s *summedObjective) SampleGrads(params []*autofunc.Variable,
+	samples sgd.SampleSet) []ConstParamDelta {
+	sg, ok := s.Wrapped.(SampleGradienter)
+	if !ok {
+		// QuadGrad on a single sample scales the normalized
+		// gradient by that sample's weight.
+		return quadGradSamples(params, s, samples)
+	}
+	res := sg.SampleGrads(params, samples)
+	weight := totalWeight(samples)
+	for _, grad := range res {
+		grad.Scale(weight)
+	}
+	return res
+}
@@ -53,6 +53,116 @@ func TestDampedNeuralLearner(t *testing.T) {
 	testLearner(t, learner, sampleSet)
 }
 
+func TestDampedNeuralLearnerGroups(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  30,
+			OutputCount: 20,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  20,
+			OutputCount: 30,
+		},
+	}
+	network.Randomize()
+
+	params := network.Parameters()
+	learner := &DampingLearner{
+		WrappedLearner: &NeuralNetLearner{
+			Layers:         network,
+			Output:         nil,
+			Cost:           neuralnet.SigmoidCECost{},
+			MaxSubBatch:    10,
+			MaxConcurrency: 1,
+		},
+		DampingCoeff: 1,
+		Groups: []*DampingGroup{
+			{Name: "first", Params: params[:2], Scale: 3},
+			{Name: "second", Params: params[2:3], Scale: 0.5, Adaptive: true},
+		},
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 50; i++ {
+		vec := make(linalg.Vector, 30)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	sampleSet := neuralnet.VectorSampleSet(inputs, inputs)
+
+	testLearner(t, learner, sampleSet)
+
+	objective := learner.MakeObjective()
+	undamped := objective.(*dampedObjective).WrappedObjective
+	for _, group := range learner.Groups {
+		delta := ConstParamDelta{}
+		for _, v := range params {
+			delta[v] = make(linalg.Vector, len(v.Vector))
+		}
+		var mag2 float64
+		for _, v := range group.Params {
+			for i := range delta[v] {
+				delta[v][i] = rand.NormFloat64() * learnerTestOffset
+				mag2 += delta[v][i] * delta[v][i]
+			}
+		}
+		actual := objective.Quad(delta, sampleSet) - undamped.Quad(delta, sampleSet)
+		expected := mag2 * group.Scale * learner.DampingCoeff * float64(sampleSet.Len())
+		if math.Abs(actual-expected) > learnerTestPrec {
+			t.Error("group", group.Name, "damping should be", expected, "but got", actual)
+		}
+	}
+}
+
+func TestDampedNeuralLearnerDiagonal(t *testing.T) {
+	diagonals := []DampingDiagonal{
+		&GaussNewtonDiagonal{},
+		&FisherDiagonal{MaxSamples: 10},
+		&MagnitudeDiagonal{},
+	}
+	for _, diagonal := range diagonals {
+		network := neuralnet.Network{
+			&neuralnet.DenseLayer{
+				InputCount:  30,
+				OutputCount: 20,
+			},
+			neuralnet.Sigmoid{},
+			&neuralnet.DenseLayer{
+				InputCount:  20,
+				OutputCount: 30,
+			},
+		}
+		network.Randomize()
+
+		learner := &DampingLearner{
+			WrappedLearner: &NeuralNetLearner{
+				Layers:         network,
+				Output:         nil,
+				Cost:           neuralnet.SigmoidCECost{},
+				MaxSubBatch:    10,
+				MaxConcurrency: 1,
+			},
+			DampingCoeff: 1,
+			Diagonal:     diagonal,
+		}
+
+		var inputs []linalg.Vector
+		for i := 0; i < 50; i++ {
+			vec := make(linalg.Vector, 30)
+			for i := range vec {
+				vec[i] = rand.Float64()
+			}
+			inputs = append(inputs, vec)
+		}
+		sampleSet := neuralnet.VectorSampleSet(inputs, inputs)
+
+		testLearner(t, learner, sampleSet)
+	}
+}
+
 func BenchmarkDampedNeuralLearnerQuadHessian(b *testing.B) {
 	network := neuralnet.Network{
 		&neuralnet.DenseLayer{
@@ -113,13 +223,13 @@ func testLearner(t *testing.T, l Learner, s sgd.SampleSet) {
 		t.Error("Quad() gave", value, "but QuadHessian() gave", valueFromRGrad)
 	}
 
-	expectedVal := value + grad.dot(destination) + 0.5*rgrad.dot(destination)
+	expectedVal := value + grad.Dot(destination) + 0.5*rgrad.Dot(destination)
 	actualVal := objective.Quad(destination, s)
 	if math.Abs(actualVal-expectedVal) > learnerTestPrec {
 		t.Error("expected output", expectedVal, "got output", actualVal)
 	}
 
-	grad.addDelta(rgrad, 1)
+	grad.Axpy(1, rgrad)
 	actualGrad := objective.QuadGrad(destination, s)
 
 GradLoop:
@@ -152,3 +262,117 @@ func benchLearnerQuadApprox(b *testing.B, l Learner, s sgd.SampleSet) {
 		obj.QuadHessian(destination, destination, s)
 	}
 }
+
+func TestNormalizedDampedLearner(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  10,
+			OutputCount: 5,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  5,
+			OutputCount: 10,
+		},
+	}
+	network.Randomize()
+
+	summed := &DampingLearner{
+		WrappedLearner: &NeuralNetLearner{
+			Layers:         network,
+			Cost:           neuralnet.SigmoidCECost{},
+			MaxSubBatch:    4,
+			MaxConcurrency: 2,
+		},
+		DampingCoeff: 0.5,
+	}
+	normalized := &DampingLearner{
+		WrappedLearner: &NeuralNetLearner{
+			Layers:         network,
+			Cost:           neuralnet.SigmoidCECost{},
+			MaxSubBatch:    4,
+			MaxConcurrency: 2,
+			Normalize:      true,
+		},
+		DampingCoeff: 0.5,
+	}
+
+	var inputs []linalg.Vector
+	var weights []float64
+	for i := 0; i < 11; i++ {
+		vec := make(linalg.Vector, 10)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+		weights = append(weights, rand.Float64()+0.5)
+	}
+	for _, samples := range []sgd.SampleSet{
+		neuralnet.VectorSampleSet(inputs, inputs),
+		WeightedSampleSet(inputs, inputs, weights),
+	} {
+		testLearner(t, normalized, samples)
+
+		delta := ConstParamDelta{}
+		for _, v := range network.Parameters() {
+			delta[v] = make(linalg.Vector, len(v.Vector))
+			for i := range delta[v] {
+				delta[v][i] = rand.NormFloat64() * learnerTestOffset
+			}
+		}
+
+		weight := totalWeight(samples)
+		regularizer := &L2Regularizer{Coeff: 0.1}
+		sumReg := (&RegularizedLearner{WrappedLearner: summed,
+			Regularizer: regularizer}).MakeObjective()
+		meanReg := (&RegularizedLearner{WrappedLearner: normalized,
+			Regularizer: regularizer}).MakeObjective()
+		sumObj := summed.MakeObjective()
+		meanObj := normalized.MakeObjective()
+		pairs := [][2]float64{
+			{sumObj.Objective(delta, samples), meanObj.Objective(delta, samples)},
+			{sumObj.Quad(delta, samples), meanObj.Quad(delta, samples)},
+			{sumReg.Objective(delta, samples), meanReg.Objective(delta, samples)},
+			{sumReg.Quad(delta, samples), meanReg.Quad(delta, samples)},
+		}
+		for i, pair := range pairs {
+			expected := pair[0] / weight
+			if math.Abs(pair[1]-expected) > learnerTestPrec {
+				t.Errorf("value %d: expected %f but got %f", i, expected, pair[1])
+			}
+		}
+
+		sumGrad := sumObj.QuadGrad(delta, samples)
+		sumGrad.Scale(1 / weight)
+		sumGrad.Axpy(-1, meanObj.QuadGrad(delta, samples))
+		if sumGrad.Norm() > learnerTestPrec {
+			t.Error("unexpected gradient difference", sumGrad.Norm())
+		}
+	}
+
+	if !normalized.Normalized() || summed.Normalized() {
+		t.Error("DampingLearner should inherit normalization")
+	}
+
+	normalized.Diagonal = &GaussNewtonDiagonal{}
+	testLearner(t, normalized, WeightedSampleSet(inputs, inputs, weights))
+}
+
+func TestDampingLearnerEvaluate(t *testing.T) {
+	learner, samples := trainerTestLearner()
+	regularized := &RegularizedLearner{
+		WrappedLearner: learner,
+		Regularizer:    &L2Regularizer{Coeff: 0.1},
+	}
+
+	objective := regularized.MakeObjective()
+	expected := objective.Objective(ConstParamDelta{}, samples)
+	lastObjective := learner.lastObjective
+
+	if actual := evaluate(regularized, samples); math.Abs(actual-expected) > learnerTestPrec {
+		t.Error("expected cost", expected, "but got", actual)
+	}
+	if learner.lastObjective != lastObjective {
+		t.Error("Evaluate should not create a new damped objective")
+	}
+}
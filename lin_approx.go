@@ -28,12 +28,32 @@ func LinApprox(b autofunc.RBatcher, d ParamDelta, ins linalg.Vector, n int) auto
 
 // LinApproxR is like LinApprox but with R-operator
 // support.
+//
+// In general, the output and R-output of the result are
+// Jacobian products with two different vectors, so two
+// R-forward passes are needed.
+// When the delta's output is zero (as it is when the
+// result is used to compute Gauss-Newton products), only
+// one R-forward pass is performed.
+// GaussNewtonProduct computes Gauss-Newton products
+// directly, without building a linear approximation.
 func LinApproxR(b autofunc.RBatcher, d ParamRDelta, ins linalg.Vector, n int) autofunc.RResult {
 	insVar := &autofunc.Variable{Vector: ins}
 	insRVar := autofunc.NewRVariable(insVar, autofunc.RVector{})
 
-	output := b.BatchR(d.outputRVector(), insRVar, n)
 	outputR := b.BatchR(d.rOutputRVector(), insRVar, n)
+	if zeroRVector(d.outputRVector()) {
+		// The Jacobian is the same for any R-vector, so the
+		// R-output's pass can be used for back-propagation.
+		return &linearizerRResult{
+			OutputVec:     outputR.Output().Copy(),
+			ROutputVec:    outputR.ROutput(),
+			BatcherOutput: outputR,
+
+			Delta: d,
+		}
+	}
+	output := b.BatchR(d.outputRVector(), insRVar, n)
 	return &linearizerRResult{
 		OutputVec:     output.Output().Copy().Add(output.ROutput()),
 		ROutputVec:    outputR.ROutput(),
@@ -107,11 +127,16 @@ func (l *linearizerRResult) PropagateRGradient(upstream, upstreamR linalg.Vector
 	rGradient := l.Delta.zeroGradient()
 
 	// Back-propagation is equivalent to left-multiplication by the Jacobian.
+	// Passes with a zero upstream would produce zero gradients.
 	zeroVec := make(linalg.Vector, len(upstream))
-	l.BatcherOutput.PropagateRGradient(upstream, zeroVec, autofunc.RGradient{},
-		gradient)
-	l.BatcherOutput.PropagateRGradient(upstreamR, zeroVec, autofunc.RGradient{},
-		rGradient)
+	if !zeroVector(upstream) {
+		l.BatcherOutput.PropagateRGradient(upstream, zeroVec, autofunc.RGradient{},
+			gradient)
+	}
+	if !zeroVector(upstreamR) {
+		l.BatcherOutput.PropagateRGradient(upstreamR, zeroVec, autofunc.RGradient{},
+			rGradient)
+	}
 
 	for variable, downstream := range gradient {
 		downstreamR := rGradient[variable]
@@ -127,3 +152,97 @@ func (l *linearizerRResult) OptimizedBackprop(upstreamR linalg.Vector, rg autofu
 	}
 	l.BatcherOutput.PropagateRGradient(upstreamR, zeroVec, autofunc.RGradient{}, grad)
 }
+
+// GaussNewtonProduct applies the Gauss-Newton matrix
+// J^T*H*J to the vector v, where J is the Jacobian of the
+// batcher with respect to its parameters (holding its
+// inputs constant) and H is the Hessian of f at the
+// batcher's output.
+//
+// This uses one R-forward pass through the batcher to
+// compute J*v and one backward pass through the same
+// result to compute J^T*(H*J*v).
+func GaussNewtonProduct(b autofunc.RBatcher, f autofunc.RFunc, v ConstParamDelta,
+	ins linalg.Vector, n int) ConstParamDelta {
+	return newGaussNewtonPass(b, f, v, ins, n, nil).Product
+}
+
+// gaussNewtonPass stores the results of a single-pass
+// Gauss-Newton vector product.
+type gaussNewtonPass struct {
+	Product ConstParamDelta
+
+	// X0 is the output of the batcher.
+	X0 linalg.Vector
+
+	// F0 is the output of f at X0.
+	F0 float64
+
+	JV  linalg.Vector
+	HJV linalg.Vector
+}
+
+// newGaussNewtonPass computes a Gauss-Newton product.
+// If x0 is non-nil, it is used as the batcher's output at
+// the linearization point, e.g. when it has been cached.
+func newGaussNewtonPass(b autofunc.RBatcher, f autofunc.RFunc, v ConstParamDelta,
+	ins linalg.Vector, n int, x0 linalg.Vector) *gaussNewtonPass {
+	insRVar := autofunc.NewRVariable(&autofunc.Variable{Vector: ins}, autofunc.RVector{})
+	rVector := autofunc.RVector{}
+	for variable, vec := range v {
+		rVector[variable] = vec
+	}
+	output := b.BatchR(rVector, insRVar, n)
+
+	if x0 == nil {
+		x0 = output.Output()
+	}
+	res := &gaussNewtonPass{
+		X0: x0,
+		JV: output.ROutput(),
+	}
+	res.HJV, res.F0, _ = outputHessian(f, res.X0, res.JV)
+
+	// The Jacobian does not depend on the R-vector, so the
+	// R-forward result can be used for back-propagation.
+	grad := autofunc.Gradient{}
+	for variable := range v {
+		grad[variable] = make(linalg.Vector, len(variable.Vector))
+	}
+	output.PropagateRGradient(res.HJV, make(linalg.Vector, len(res.HJV)),
+		autofunc.RGradient{}, grad)
+	res.Product = ConstParamDelta(grad)
+
+	return res
+}
+
+// outputHessian applies the Hessian of f at x0 to v.
+// It also returns the value of f at x0 and the derivative
+// of f along v.
+func outputHessian(f autofunc.RFunc, x0, v linalg.Vector) (hv linalg.Vector,
+	value, deriv float64) {
+	inVar := &autofunc.Variable{Vector: x0}
+	inRVar := &autofunc.RVariable{Variable: inVar, ROutputVec: v}
+	result := f.ApplyR(autofunc.RVector{}, inRVar)
+	rgrad := autofunc.NewRGradient([]*autofunc.Variable{inVar})
+	result.PropagateRGradient([]float64{1}, []float64{0}, rgrad, nil)
+	return rgrad[inVar], result.Output()[0], result.ROutput()[0]
+}
+
+func zeroVector(v linalg.Vector) bool {
+	for _, x := range v {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func zeroRVector(v autofunc.RVector) bool {
+	for _, vec := range v {
+		if !zeroVector(vec) {
+			return false
+		}
+	}
+	return true
+}
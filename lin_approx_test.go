@@ -7,6 +7,7 @@ import (
 
 	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
 )
 
 const (
@@ -117,6 +118,121 @@ func TestLinearizerGradient(t *testing.T) {
 	}
 }
 
+func TestLinearizerZeroDelta(t *testing.T) {
+	params := &autofunc.Variable{Vector: []float64{0.78168, -0.26282}}
+	lt := linearizerTest{XY: params}
+	inputs := autofunc.NewRVariable(&autofunc.Variable{
+		Vector: []float64{1, 2, -0.3, 0.3},
+	}, autofunc.RVector{})
+	deltaVar := &autofunc.Variable{Vector: make(linalg.Vector, 2)}
+	delta := ParamRDelta{
+		params: autofunc.NewRVariable(deltaVar,
+			autofunc.RVector{deltaVar: []float64{0.333, -0.414}}),
+	}
+	batcher := &countingRBatcher{RBatcher: newLinearizerTestRBatcher(params)}
+
+	expected := lt.LinearBatchR(delta, inputs, 2)
+	actual := LinApproxR(batcher, delta, inputs.Output(), 2)
+
+	if batcher.Calls != 1 {
+		t.Error("expected 1 R-forward pass but got", batcher.Calls)
+	}
+	for i, x := range expected.Output() {
+		if a := actual.Output()[i]; math.Abs(a-x) > linearizerTestOutputPrecision {
+			t.Error("output", i, "should be", x, "but it's", a)
+		}
+	}
+	for i, x := range expected.ROutput() {
+		if a := actual.ROutput()[i]; math.Abs(a-x) > linearizerTestOutputPrecision {
+			t.Error("r-output", i, "should be", x, "but it's", a)
+		}
+	}
+
+	// A zero upstream vector skips one of the backward passes.
+	upstream := linalg.Vector{0.5, -1, 2, 0.25}
+	upstreamR := make(linalg.Vector, len(upstream))
+	grad := autofunc.NewGradient([]*autofunc.Variable{deltaVar})
+	actual.PropagateRGradient(upstream, upstreamR, autofunc.RGradient{}, grad)
+	expectedGrad := autofunc.NewGradient([]*autofunc.Variable{deltaVar})
+	expected.PropagateRGradient(upstream.Copy(), upstreamR.Copy(), autofunc.RGradient{},
+		expectedGrad)
+	for i, x := range expectedGrad[deltaVar] {
+		if a := grad[deltaVar][i]; math.Abs(a-x) > linearizerTestGradPrecision {
+			t.Error("gradient entry", i, "should be", x, "but it's", a)
+		}
+	}
+}
+
+func TestGaussNewtonProduct(t *testing.T) {
+	rand.Seed(123)
+
+	params := &autofunc.Variable{Vector: []float64{0.78168, -0.26282}}
+	batcher := newLinearizerTestRBatcher(params)
+	inputs := linalg.Vector{1, 2, -0.3, 0.3}
+	v := ConstParamDelta{params: []float64{0.333, -0.414}}
+
+	expected := gaussNewtonTestProduct(batcher, quadApproxTestFunc{}, v, inputs, 2)
+	actual := GaussNewtonProduct(batcher, quadApproxTestFunc{}, v, inputs, 2)
+
+	for i, x := range expected[params] {
+		a := actual[params][i]
+		if math.Abs(a-x) > linearizerTestGradPrecision {
+			t.Error("product entry", i, "should be", x, "but it's", a)
+		}
+	}
+}
+
+func BenchmarkGaussNewtonProduct(b *testing.B) {
+	network, samples := gaussNewtonCacheTestNet(100, 300, 15)
+	ins, outs, _ := joinSamples(samples)
+	batcher := network.BatchLearner()
+	f := &netOutFunc{
+		CostFunc:    neuralnet.SigmoidCECost{},
+		SampleOuts:  outs,
+		SampleCount: samples.Len(),
+	}
+	v := gaussNewtonCacheTestDelta(network.Parameters(), learnerTestOffset)
+
+	b.Run("LinApproxR", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			gaussNewtonTestProduct(batcher, f, v, ins, samples.Len())
+		}
+	})
+	b.Run("SinglePass", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			GaussNewtonProduct(batcher, f, v, ins, samples.Len())
+		}
+	})
+}
+
+// gaussNewtonTestProduct computes a Gauss-Newton vector
+// product using LinApproxR and QuadApproxR.
+func gaussNewtonTestProduct(b autofunc.RBatcher, f autofunc.RFunc, v ConstParamDelta,
+	ins linalg.Vector, n int) ConstParamDelta {
+	rDelta := ParamRDelta{}
+	var tempVars []*autofunc.Variable
+	for variable, vec := range v {
+		tempVar := &autofunc.Variable{Vector: make(linalg.Vector, len(vec))}
+		rDelta[variable] = &autofunc.RVariable{
+			Variable:   tempVar,
+			ROutputVec: vec,
+		}
+		tempVars = append(tempVars, tempVar)
+	}
+	layerOutput := LinApproxR(b, rDelta, ins, n)
+	x0 := layerOutput.(*linearizerRResult).BatcherOutput.Output()
+	output := QuadApproxR(f, x0, layerOutput)
+
+	rgrad := autofunc.NewRGradient(tempVars)
+	output.PropagateRGradient([]float64{1}, []float64{0}, rgrad, nil)
+
+	res := ConstParamDelta{}
+	for variable, r := range rDelta {
+		res[variable] = rgrad[r.(*autofunc.RVariable).Variable]
+	}
+	return res
+}
+
 func linearizerTestOutputs() (actual, expected autofunc.Result, deltaVar *autofunc.Variable) {
 	params := &autofunc.Variable{Vector: []float64{0.78168, -0.26282}}
 	lt := linearizerTest{XY: params}
@@ -237,3 +353,14 @@ func (l *linearizerTestFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) aut
 		autofunc.MulR(b, autofunc.PowR(autofunc.Cos{}.ApplyR(v, autofunc.MulR(a, y)), 2)))
 	return autofunc.ConcatR(out1, out2)
 }
+
+type countingRBatcher struct {
+	autofunc.RBatcher
+	Calls int
+}
+
+func (c *countingRBatcher) BatchR(v autofunc.RVector, in autofunc.RResult,
+	n int) autofunc.RResult {
+	c.Calls++
+	return c.RBatcher.BatchR(v, in, n)
+}
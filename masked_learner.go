@@ -0,0 +1,138 @@
+package hessfree
+
+import (
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+// A MaskedLearner wraps a Learner and restricts which of
+// its parameters may be changed.
+//
+// Frozen variables are excluded from Parameters(), so
+// they never appear in the deltas produced by training.
+// Masked variables are included, but the masked entries
+// of every delta, gradient, and Hessian product are zero.
+type MaskedLearner struct {
+	WrappedLearner Learner
+
+	// Frozen lists variables which should never change.
+	Frozen []*autofunc.Variable
+
+	// Masks optionally maps variables to element masks.
+	// An entry may only change if the corresponding mask
+	// entry is non-zero.
+	// Mask entries are multiplied by deltas, so they should
+	// usually be 0 or 1.
+	Masks map[*autofunc.Variable]linalg.Vector
+}
+
+// Parameters returns the wrapped learner's parameters,
+// excluding frozen ones.
+func (m *MaskedLearner) Parameters() []*autofunc.Variable {
+	frozen := m.frozenSet()
+	var res []*autofunc.Variable
+	for _, param := range m.WrappedLearner.Parameters() {
+		if !frozen[param] {
+			res = append(res, param)
+		}
+	}
+	return res
+}
+
+// MakeObjective creates an objective which masks its
+// inputs and outputs.
+func (m *MaskedLearner) MakeObjective() Objective {
+	return &maskedObjective{
+		Wrapped: m.WrappedLearner.MakeObjective(),
+		Frozen:  m.frozenSet(),
+		Masks:   m.Masks,
+	}
+}
+
+// Evaluate evaluates the wrapped learner.
+func (m *MaskedLearner) Evaluate(s sgd.SampleSet) float64 {
+	return evaluate(m.WrappedLearner, s)
+}
+
+// Adjust masks the deltas and passes them to the wrapped
+// learner.
+func (m *MaskedLearner) Adjust(delta, quadMin ConstParamDelta, s sgd.SampleSet) {
+	frozen := m.frozenSet()
+	m.WrappedLearner.Adjust(maskDelta(delta, frozen, m.Masks),
+		maskDelta(quadMin, frozen, m.Masks), s)
+}
+
+func (m *MaskedLearner) frozenSet() map[*autofunc.Variable]bool {
+	res := map[*autofunc.Variable]bool{}
+	for _, v := range m.Frozen {
+		res[v] = true
+	}
+	return res
+}
+
+type maskedObjective struct {
+	Wrapped Objective
+	Frozen  map[*autofunc.Variable]bool
+	Masks   map[*autofunc.Variable]linalg.Vector
+}
+
+func (m *maskedObjective) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	return m.Wrapped.Quad(maskDelta(delta, m.Frozen, m.Masks), s)
+}
+
+func (m *maskedObjective) QuadGrad(delta ConstParamDelta, s sgd.SampleSet) ConstParamDelta {
+	res := m.Wrapped.QuadGrad(maskDelta(delta, m.Frozen, m.Masks), s)
+	m.maskInPlace(res)
+	return res
+}
+
+func (m *maskedObjective) QuadHessian(delta, x ConstParamDelta,
+	s sgd.SampleSet) (ConstParamDelta, float64) {
+	res, val := m.Wrapped.QuadHessian(maskDelta(delta, m.Frozen, m.Masks),
+		maskDelta(x, m.Frozen, m.Masks), s)
+	m.maskInPlace(res)
+	return res, val
+}
+
+func (m *maskedObjective) Objective(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	return m.Wrapped.Objective(maskDelta(delta, m.Frozen, m.Masks), s)
+}
+
+func (m *maskedObjective) maskInPlace(d ConstParamDelta) {
+	for variable, vec := range d {
+		if m.Frozen[variable] {
+			delete(d, variable)
+		} else if mask, ok := m.Masks[variable]; ok {
+			for i, x := range mask {
+				vec[i] *= x
+			}
+		}
+	}
+}
+
+// maskDelta creates a version of the delta without any
+// frozen variables and with every mask applied.
+// Vectors without masks are shared with the original.
+func maskDelta(d ConstParamDelta, frozen map[*autofunc.Variable]bool,
+	masks map[*autofunc.Variable]linalg.Vector) ConstParamDelta {
+	if d == nil {
+		return nil
+	}
+	res := make(ConstParamDelta, len(d))
+	for variable, vec := range d {
+		if frozen[variable] {
+			continue
+		}
+		if mask, ok := masks[variable]; ok {
+			masked := make(linalg.Vector, len(vec))
+			for i, x := range vec {
+				masked[i] = x * mask[i]
+			}
+			res[variable] = masked
+		} else {
+			res[variable] = vec
+		}
+	}
+	return res
+}
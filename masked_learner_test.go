@@ -0,0 +1,90 @@
+package hessfree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestMaskedLearner(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  10,
+			OutputCount: 5,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  5,
+			OutputCount: 10,
+		},
+	}
+	network.Randomize()
+
+	params := network.Parameters()
+	frozen := params[0]
+	masked := params[2]
+	mask := make(linalg.Vector, len(masked.Vector))
+	for i := range mask {
+		mask[i] = float64(i % 2)
+	}
+
+	learner := &DampingLearner{
+		WrappedLearner: &MaskedLearner{
+			WrappedLearner: &NeuralNetLearner{
+				Layers:         network,
+				Cost:           neuralnet.SigmoidCECost{},
+				MaxConcurrency: 1,
+			},
+			Frozen: params[:1],
+			Masks:  map[*autofunc.Variable]linalg.Vector{masked: mask},
+		},
+	}
+
+	for _, param := range learner.Parameters() {
+		if param == frozen {
+			t.Fatal("frozen parameter should not be listed")
+		}
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 20; i++ {
+		vec := make(linalg.Vector, 10)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	samples := neuralnet.VectorSampleSet(inputs, inputs)
+
+	testLearner(t, learner, samples)
+
+	frozenBackup := frozen.Vector.Copy()
+	maskedBackup := masked.Vector.Copy()
+	trainer := &Trainer{
+		Learner:   learner,
+		Samples:   samples,
+		BatchSize: 10,
+		UI:        &recordingUI{stopEpoch: 1},
+	}
+	trainer.Train()
+
+	for i, x := range frozenBackup {
+		if frozen.Vector[i] != x {
+			t.Fatal("frozen parameter changed")
+		}
+	}
+	var changed bool
+	for i, x := range maskedBackup {
+		if mask[i] == 0 && masked.Vector[i] != x {
+			t.Fatal("masked entry changed")
+		} else if mask[i] != 0 && masked.Vector[i] != x {
+			changed = true
+		}
+	}
+	if !changed {
+		t.Error("unmasked entries should change")
+	}
+}
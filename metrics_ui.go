@@ -0,0 +1,222 @@
+package hessfree
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricsUI is a UI which keeps counters and gauges about
+// training and serves them in the Prometheus text
+// exposition format.
+//
+// MetricsUI never asks training to stop, so it is usually
+// combined with another UI using a MultiUI.
+type MetricsUI struct {
+	server   *http.Server
+	listener net.Listener
+
+	lock          sync.Mutex
+	cgIterations  int64
+	miniBatches   int64
+	epochs        int64
+	objective     float64
+	validation    float64
+	damping       float64
+	reduction     float64
+	timingSums    map[string]float64
+	timingCounts  map[string]int64
+	lastQuadValue float64
+}
+
+// NewMetricsUI creates a MetricsUI which is not attached
+// to a listener.
+// It can be served manually, since it implements
+// http.Handler.
+func NewMetricsUI() *MetricsUI {
+	nan := math.NaN()
+	return &MetricsUI{
+		objective:     nan,
+		validation:    nan,
+		damping:       nan,
+		reduction:     nan,
+		lastQuadValue: nan,
+		timingSums:    map[string]float64{},
+		timingCounts:  map[string]int64{},
+	}
+}
+
+// ListenMetricsUI creates a MetricsUI and serves it at
+// "/metrics" on the given address.
+func ListenMetricsUI(addr string) (*MetricsUI, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	res := NewMetricsUI()
+	res.listener = listener
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", res)
+	res.server = &http.Server{Handler: mux}
+	go res.server.Serve(listener)
+	return res, nil
+}
+
+// Addr returns the address of the listener, or nil if the
+// UI was not created with ListenMetricsUI.
+func (m *MetricsUI) Addr() net.Addr {
+	if m.listener == nil {
+		return nil
+	}
+	return m.listener.Addr()
+}
+
+// Close stops the HTTP server, if there is one.
+func (m *MetricsUI) Close() error {
+	if m.server == nil {
+		return nil
+	}
+	return m.server.Close()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text
+// exposition format.
+func (m *MetricsUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(m.Exposition())
+}
+
+// Exposition returns the current metrics in the
+// Prometheus text exposition format.
+func (m *MetricsUI) Exposition() []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var buf bytes.Buffer
+	writeMetric := func(name, kind, help string, value float64) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name,
+			kind, name, formatMetric(value))
+	}
+	writeMetric("hessfree_cg_iterations_total", "counter",
+		"Total number of CG iterations.", float64(m.cgIterations))
+	writeMetric("hessfree_mini_batches_total", "counter",
+		"Total number of mini-batches processed.", float64(m.miniBatches))
+	writeMetric("hessfree_epochs_total", "counter",
+		"Total number of completed epochs.", float64(m.epochs))
+	writeMetric("hessfree_objective", "gauge",
+		"Objective value for the last chosen update.", m.objective)
+	writeMetric("hessfree_quad_value", "gauge",
+		"Last value of the quadratic approximation.", m.lastQuadValue)
+	writeMetric("hessfree_validation_cost", "gauge",
+		"Last validation cost.", m.validation)
+	writeMetric("hessfree_damping_coefficient", "gauge",
+		"Current damping coefficient.", m.damping)
+	writeMetric("hessfree_reduction_ratio", "gauge",
+		"Last ratio of actual to predicted reduction.", m.reduction)
+
+	var names []string
+	for name := range m.timingCounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf.WriteString("# HELP hessfree_timing_seconds Time spent in stages of training.\n")
+	buf.WriteString("# TYPE hessfree_timing_seconds summary\n")
+	for _, name := range names {
+		label := strconv.Quote(name)
+		fmt.Fprintf(&buf, "hessfree_timing_seconds_sum{stage=%s} %s\n", label,
+			formatMetric(m.timingSums[name]))
+		fmt.Fprintf(&buf, "hessfree_timing_seconds_count{stage=%s} %d\n", label,
+			m.timingCounts[name])
+	}
+
+	return buf.Bytes()
+}
+
+func (m *MetricsUI) LogCGStart(initQuad, quadLast float64) {
+	m.lock.Lock()
+	m.lastQuadValue = initQuad
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) LogCGIteration(stepSize, quadValue float64) {
+	m.lock.Lock()
+	m.cgIterations++
+	m.lastQuadValue = quadValue
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) LogNewMiniBatch(epochNum, batchNum int) {
+	m.lock.Lock()
+	m.miniBatches++
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) Log(sender, message string) {
+}
+
+// ShouldStop always returns false.
+func (m *MetricsUI) ShouldStop() bool {
+	return false
+}
+
+func (m *MetricsUI) LogDamping(trust, coeff float64) {
+	m.lock.Lock()
+	m.damping = coeff
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) LogBacktrack(iteration int, objective float64) {
+}
+
+func (m *MetricsUI) LogUpdate(iterations int, objective float64) {
+	m.lock.Lock()
+	m.objective = objective
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) LogReductionRatio(ratio float64) {
+	m.lock.Lock()
+	m.reduction = ratio
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) LogEpochEnd(epoch int) {
+	m.lock.Lock()
+	m.epochs++
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) LogValidation(epoch int, cost float64) {
+	m.lock.Lock()
+	m.validation = cost
+	m.lock.Unlock()
+}
+
+func (m *MetricsUI) LogTiming(name string, duration time.Duration) {
+	m.lock.Lock()
+	if m.timingSums == nil {
+		m.timingSums = map[string]float64{}
+		m.timingCounts = map[string]int64{}
+	}
+	m.timingSums[name] += duration.Seconds()
+	m.timingCounts[name]++
+	m.lock.Unlock()
+}
+
+func formatMetric(x float64) string {
+	switch {
+	case math.IsNaN(x):
+		return "NaN"
+	case math.IsInf(x, 1):
+		return "+Inf"
+	case math.IsInf(x, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
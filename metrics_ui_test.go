@@ -0,0 +1,51 @@
+package hessfree
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsUI(t *testing.T) {
+	ui := NewMetricsUI()
+	ui.LogNewMiniBatch(0, 0)
+	ui.LogCGStart(1, 2)
+	ui.LogCGIteration(0.5, 0.25)
+	ui.LogCGIteration(0.5, 0.125)
+	ui.LogDamping(0.5, 1.5)
+	ui.LogReductionRatio(0.5)
+	ui.LogUpdate(2, 0.75)
+	ui.LogTiming(TimingQuadHessian, time.Second)
+	ui.LogTiming(TimingQuadHessian, time.Second/2)
+
+	output := string(ui.Exposition())
+	expectedLines := []string{
+		"hessfree_cg_iterations_total 2",
+		"hessfree_mini_batches_total 1",
+		"hessfree_objective 0.75",
+		"hessfree_quad_value 0.125",
+		"hessfree_damping_coefficient 1.5",
+		"hessfree_reduction_ratio 0.5",
+		"hessfree_validation_cost NaN",
+		`hessfree_timing_seconds_sum{stage="quad_hessian"} 1.5`,
+		`hessfree_timing_seconds_count{stage="quad_hessian"} 2`,
+	}
+	lines := map[string]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		lines[line] = true
+	}
+	for _, line := range expectedLines {
+		if !lines[line] {
+			t.Error("missing line:", line)
+		}
+	}
+}
+
+func TestMetricsUIZeroValue(t *testing.T) {
+	var ui MetricsUI
+	ui.LogTiming(TimingCG, time.Second)
+	output := string(ui.Exposition())
+	if !strings.Contains(output, `hessfree_timing_seconds_count{stage="cg"} 1`) {
+		t.Error("missing timing in output:", output)
+	}
+}
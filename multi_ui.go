@@ -0,0 +1,218 @@
+package hessfree
+
+import "time"
+
+// MultiUI is a UI which forwards every event to a list of
+// UIs.
+// Typed events are only forwarded to the UIs which
+// implement the corresponding interface.
+type MultiUI []UI
+
+func (m MultiUI) LogCGStart(initQuad, quadLast float64) {
+	for _, ui := range m {
+		ui.LogCGStart(initQuad, quadLast)
+	}
+}
+
+func (m MultiUI) LogCGIteration(stepSize, quadValue float64) {
+	for _, ui := range m {
+		ui.LogCGIteration(stepSize, quadValue)
+	}
+}
+
+func (m MultiUI) LogNewMiniBatch(epochNum, batchNum int) {
+	for _, ui := range m {
+		ui.LogNewMiniBatch(epochNum, batchNum)
+	}
+}
+
+func (m MultiUI) Log(sender, message string) {
+	for _, ui := range m {
+		ui.Log(sender, message)
+	}
+}
+
+// ShouldStop returns true if any of the UIs wants to stop.
+func (m MultiUI) ShouldStop() bool {
+	for _, ui := range m {
+		if ui.ShouldStop() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m MultiUI) LogDamping(trust, coeff float64) {
+	for _, ui := range m {
+		if logger, ok := ui.(DampingLogger); ok {
+			logger.LogDamping(trust, coeff)
+		}
+	}
+}
+
+func (m MultiUI) LogBacktrack(iteration int, objective float64) {
+	m.forEachEventUI(func(e EventUI) {
+		e.LogBacktrack(iteration, objective)
+	})
+}
+
+func (m MultiUI) LogUpdate(iterations int, objective float64) {
+	m.forEachEventUI(func(e EventUI) {
+		e.LogUpdate(iterations, objective)
+	})
+}
+
+func (m MultiUI) LogReductionRatio(ratio float64) {
+	m.forEachEventUI(func(e EventUI) {
+		e.LogReductionRatio(ratio)
+	})
+}
+
+func (m MultiUI) LogEpochEnd(epoch int) {
+	m.forEachEventUI(func(e EventUI) {
+		e.LogEpochEnd(epoch)
+	})
+}
+
+// LogValidation forwards the cost to every UI, using a
+// Log message for UIs which are not EventUIs.
+func (m MultiUI) LogValidation(epoch int, cost float64) {
+	for _, ui := range m {
+		logValidationCost(ui, epoch, cost)
+	}
+}
+
+func (m MultiUI) LogTiming(name string, duration time.Duration) {
+	m.forEachEventUI(func(e EventUI) {
+		e.LogTiming(name, duration)
+	})
+}
+
+func (m MultiUI) forEachEventUI(f func(e EventUI)) {
+	for _, ui := range m {
+		if e, ok := ui.(EventUI); ok {
+			f(e)
+		}
+	}
+}
+
+// Verbosity is a level of detail for UI events.
+// Higher verbosities include all the events of lower
+// verbosities.
+// The zero Verbosity includes every event.
+type Verbosity int
+
+const (
+	// VerbosityEpochs includes epoch ends and validation.
+	VerbosityEpochs Verbosity = iota + 1
+
+	// VerbosityBatches adds mini-batches, chosen updates,
+	// damping changes, timings and Log messages.
+	VerbosityBatches
+
+	// VerbosityCG adds CG starts and backtracking.
+	VerbosityCG
+
+	// VerbosityIterations adds every CG iteration.
+	VerbosityIterations
+)
+
+// FilterUI is a UI which drops events that are more
+// detailed than its Verbosity before forwarding them to
+// a wrapped UI.
+// ShouldStop calls are always forwarded.
+type FilterUI struct {
+	UI UI
+
+	// Verbosity is the most detailed level of events to
+	// forward.
+	// If this is 0, every event is forwarded.
+	Verbosity Verbosity
+}
+
+func (f *FilterUI) LogCGStart(initQuad, quadLast float64) {
+	if f.allows(VerbosityCG) {
+		f.UI.LogCGStart(initQuad, quadLast)
+	}
+}
+
+func (f *FilterUI) LogCGIteration(stepSize, quadValue float64) {
+	if f.allows(VerbosityIterations) {
+		f.UI.LogCGIteration(stepSize, quadValue)
+	}
+}
+
+func (f *FilterUI) LogNewMiniBatch(epochNum, batchNum int) {
+	if f.allows(VerbosityBatches) {
+		f.UI.LogNewMiniBatch(epochNum, batchNum)
+	}
+}
+
+func (f *FilterUI) Log(sender, message string) {
+	if f.allows(VerbosityBatches) {
+		f.UI.Log(sender, message)
+	}
+}
+
+func (f *FilterUI) ShouldStop() bool {
+	return f.UI.ShouldStop()
+}
+
+func (f *FilterUI) LogDamping(trust, coeff float64) {
+	if logger, ok := f.UI.(DampingLogger); ok && f.allows(VerbosityBatches) {
+		logger.LogDamping(trust, coeff)
+	}
+}
+
+func (f *FilterUI) LogBacktrack(iteration int, objective float64) {
+	if e, ok := f.eventUI(VerbosityCG); ok {
+		e.LogBacktrack(iteration, objective)
+	}
+}
+
+func (f *FilterUI) LogUpdate(iterations int, objective float64) {
+	if e, ok := f.eventUI(VerbosityBatches); ok {
+		e.LogUpdate(iterations, objective)
+	}
+}
+
+func (f *FilterUI) LogReductionRatio(ratio float64) {
+	if e, ok := f.eventUI(VerbosityBatches); ok {
+		e.LogReductionRatio(ratio)
+	}
+}
+
+func (f *FilterUI) LogEpochEnd(epoch int) {
+	if e, ok := f.eventUI(VerbosityEpochs); ok {
+		e.LogEpochEnd(epoch)
+	}
+}
+
+// LogValidation forwards the cost like MultiUI does.
+func (f *FilterUI) LogValidation(epoch int, cost float64) {
+	if f.allows(VerbosityEpochs) {
+		logValidationCost(f.UI, epoch, cost)
+	}
+}
+
+func (f *FilterUI) LogTiming(name string, duration time.Duration) {
+	if e, ok := f.eventUI(VerbosityBatches); ok {
+		e.LogTiming(name, duration)
+	}
+}
+
+// allows checks if events at the given verbosity should
+// be forwarded.
+func (f *FilterUI) allows(level Verbosity) bool {
+	return f.Verbosity == 0 || f.Verbosity >= level
+}
+
+// eventUI returns the wrapped UI as an EventUI if it is
+// one and if events at the given verbosity are allowed.
+func (f *FilterUI) eventUI(level Verbosity) (EventUI, bool) {
+	if !f.allows(level) {
+		return nil, false
+	}
+	e, ok := f.UI.(EventUI)
+	return e, ok
+}
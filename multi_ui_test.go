@@ -0,0 +1,85 @@
+package hessfree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMultiUI(t *testing.T) {
+	ui1 := &recordingUI{stopEpoch: 1}
+	ui2 := &recordingUI{stopEpoch: 2}
+	multi := MultiUI{ui1, nopUI{}, ui2}
+
+	multi.LogUpdate(3, 1)
+	multi.LogDamping(0.5, 1)
+	if ui1.updates != 1 || ui2.updates != 1 || ui1.dampings != 1 || ui2.dampings != 1 {
+		t.Error("events should reach every EventUI")
+	}
+
+	if multi.ShouldStop() {
+		t.Error("no UI should want to stop yet")
+	}
+	multi.LogEpochEnd(0)
+	if !multi.ShouldStop() {
+		t.Error("first UI should want to stop")
+	}
+}
+
+func TestFilterUI(t *testing.T) {
+	ui := &recordingUI{}
+	filter := &FilterUI{UI: ui, Verbosity: VerbosityBatches}
+
+	filter.LogBacktrack(1, 1)
+	filter.LogUpdate(1, 1)
+	filter.LogEpochEnd(0)
+	if ui.backtracks != 0 {
+		t.Error("backtracks should be filtered")
+	}
+	if ui.updates != 1 || ui.epochs != 1 {
+		t.Error("updates and epochs should be forwarded")
+	}
+
+	filter.Verbosity = VerbosityEpochs
+	filter.LogUpdate(1, 1)
+	if ui.updates != 1 {
+		t.Error("updates should be filtered")
+	}
+}
+
+func TestFilterUIZeroValue(t *testing.T) {
+	ui := &recordingUI{}
+	filter := &FilterUI{UI: ui}
+
+	filter.LogBacktrack(1, 1)
+	filter.LogUpdate(1, 1)
+	filter.LogEpochEnd(0)
+	if ui.backtracks != 1 || ui.updates != 1 || ui.epochs != 1 {
+		t.Error("the zero verbosity should forward every event")
+	}
+}
+
+func TestMultiUIValidationLog(t *testing.T) {
+	plain := &messageUI{}
+	events := &recordingUI{}
+	for _, ui := range []UI{MultiUI{plain, events}, &FilterUI{UI: MultiUI{plain, events}},
+		&FilterUI{UI: plain, Verbosity: VerbosityEpochs}} {
+		plain.messages = nil
+		ui.(EventUI).LogValidation(0, 1.5)
+		if len(plain.messages) != 1 || !strings.Contains(plain.messages[0], "1.5") {
+			t.Error("plain UI should log the validation cost but got", plain.messages)
+		}
+	}
+	if events.validations != 2 {
+		t.Error("expected 2 validations but got", events.validations)
+	}
+}
+
+// messageUI records the messages passed to Log.
+type messageUI struct {
+	nopUI
+	messages []string
+}
+
+func (m *messageUI) Log(sender, message string) {
+	m.messages = append(m.messages, message)
+}
@@ -26,6 +26,52 @@ type GaussNewtonNN struct {
 	Output autofunc.RBatcher
 
 	Cost neuralnet.CostFunc
+
+	// Normalize specifies that the objective should be the
+	// mean cost per sample (weighted by the sample weights)
+	// rather than the total cost.
+	// When wrapping a GaussNewtonNN in a ConcurrentObjective,
+	// set Normalize on the ConcurrentObjective instead;
+	// ConcurrentObjective panics if this is set.
+	Normalize bool
+
+	// CacheBatchState specifies that QuadHessian should keep
+	// state for each sample set it sees: the joined samples,
+	// the output of the layers and the output function's
+	// value and gradient at the linearization point, and the
+	// images of the last point and direction under the
+	// Jacobian.
+	//
+	// With this state, a call whose point lies on the line
+	// through the last point and direction (as in CG) runs
+	// one R-forward and one backward pass through Layers,
+	// instead of an extra R-forward pass for the point.
+	// The forward pass through Layers is still repeated as
+	// part of the R-forward pass, since an RBatcher computes
+	// both at once.
+	//
+	// The state assumes that the underlying parameters do
+	// not change while the GaussNewtonNN is in use, which
+	// is the case for objectives created by a Learner.
+	//
+	// Sample sets are identified by their memory, not their
+	// contents.
+	// For sample sets which are pointers, and whose Subset
+	// method allocates a new value on every call, each
+	// sub-batch of a ConcurrentObjective gets a new entry.
+	// Such entries are never reused, but they hold the
+	// joined samples until they are evicted, which happens
+	// once there are 1024 entries.
+	// NeuralNetLearner and GenericLearner enable this
+	// option, so they have this limitation.
+	CacheBatchState bool
+
+	cache gaussNewtonCache
+}
+
+// Normalized returns g.Normalize.
+func (g *GaussNewtonNN) Normalized() bool {
+	return g.Normalize
 }
 
 // Quad evaluates the Gauss-Newton approximation
@@ -35,7 +81,7 @@ func (g *GaussNewtonNN) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
 	for variable, d := range delta {
 		argDelta[variable] = &autofunc.Variable{Vector: d}
 	}
-	return g.objective(argDelta, s).Output()[0]
+	return g.normalizer(s) * g.objective(argDelta, s).Output()[0]
 }
 
 // QuadGradient computes the gradient of Gauss-Newton
@@ -53,7 +99,7 @@ func (g *GaussNewtonNN) QuadGrad(delta ConstParamDelta, s sgd.SampleSet) ConstPa
 	output := g.objective(argDelta, s)
 
 	grad := autofunc.NewGradient(tempVariables)
-	output.PropagateGradient([]float64{1}, grad)
+	output.PropagateGradient([]float64{g.normalizer(s)}, grad)
 
 	res := ConstParamDelta{}
 	for i, mapVariable := range mapVariables {
@@ -67,42 +113,57 @@ func (g *GaussNewtonNN) QuadGrad(delta ConstParamDelta, s sgd.SampleSet) ConstPa
 // evaluating the approximation at x.
 func (g *GaussNewtonNN) QuadHessian(delta, x ConstParamDelta, s sgd.SampleSet) (ConstParamDelta,
 	float64) {
-	rDelta := ParamRDelta{}
-	var tempVariables []*autofunc.Variable
-	var mapVariables []*autofunc.Variable
-	for variable, d := range delta {
-		tempVar := &autofunc.Variable{Vector: x[variable]}
-		rDelta[variable] = &autofunc.RVariable{
-			Variable:   tempVar,
-			ROutputVec: d,
-		}
-		tempVariables = append(tempVariables, tempVar)
-		mapVariables = append(mapVariables, variable)
+	var entry *gaussNewtonEntry
+	if g.CacheBatchState {
+		entry = g.cache.entry(s)
 	}
-	output := g.objectiveR(rDelta, s)
-
-	rgrad := autofunc.NewRGradient(tempVariables)
-	output.PropagateRGradient([]float64{1}, []float64{0}, rgrad, nil)
-
-	res := ConstParamDelta{}
-	for i, mapVariable := range mapVariables {
-		res[mapVariable] = rgrad[tempVariables[i]]
+	if entry == nil {
+		entry = newGaussNewtonEntry(s)
 	}
-	return res, output.Output()[0]
+	res, value := g.quadHessian(entry, delta, x, s.Len())
+	scaler := g.normalizer(s)
+	if scaler != 1 {
+		res.Scale(scaler)
+	}
+	return res, scaler * value
 }
 
 // ObjectiveAtZero applies the actual, unapproximated
 // objective function to its underlying variables.
 func (g *GaussNewtonNN) ObjectiveAtZero(s sgd.SampleSet) float64 {
-	sampleIns, sampleOuts := joinSamples(s)
+	sampleIns, sampleOuts, weights := joinSamples(s)
 	inputs := &autofunc.Variable{Vector: sampleIns}
 	output1 := g.Layers.Batch(inputs, s.Len())
-	return g.outFunc(sampleOuts, s.Len()).Apply(output1).Output()[0]
+	cost := g.outFunc(sampleOuts, weights, s.Len()).Apply(output1).Output()[0]
+	return g.normalizer(s) * cost
+}
+
+// SampleGrads computes the gradient of the true cost of
+// each sample with respect to the given parameters.
+// This uses the network itself rather than its
+// Gauss-Newton approximation, and it runs a forward and
+// backward pass with a batch size of one for each sample,
+// since a batched backward pass sums over the samples.
+func (g *GaussNewtonNN) SampleGrads(params []*autofunc.Variable,
+	s sgd.SampleSet) []ConstParamDelta {
+	scaler := g.normalizer(s)
+	res := make([]ConstParamDelta, s.Len())
+	for i := range res {
+		sample := vectorSample(s.GetSample(i))
+		weight := sampleWeight(s.GetSample(i))
+		inVar := &autofunc.Variable{Vector: sample.Input}
+		output := g.Layers.Batch(inVar, 1)
+		cost := g.outFunc(sample.Output, nil, 1).Apply(output)
+		grad := autofunc.NewGradient(params)
+		cost.PropagateGradient([]float64{weight * scaler}, grad)
+		res[i] = ConstParamDelta(grad)
+	}
+	return res
 }
 
 // objective evaluates the approximated objective
 // (cost) function given a SampleSet full of
-// neuralnet.VectorSample instances.
+// neuralnet.VectorSample or WeightedSample instances.
 //
 // This will run all of the samples in one batch.
 //
@@ -111,46 +172,61 @@ func (g *GaussNewtonNN) ObjectiveAtZero(s sgd.SampleSet) float64 {
 // of the neural network's layers (as these are held
 // constant while the layers are linearized).
 func (g *GaussNewtonNN) objective(delta ParamDelta, s sgd.SampleSet) autofunc.Result {
-	sampleIns, sampleOuts := joinSamples(s)
+	sampleIns, sampleOuts, weights := joinSamples(s)
 	layerOutput := LinApprox(g.Layers, delta, sampleIns, s.Len())
 	x0 := layerOutput.(*linearizerResult).BatcherOutput.Output()
-	return QuadApprox(g.outFunc(sampleOuts, s.Len()), x0, layerOutput)
+	return QuadApprox(g.outFunc(sampleOuts, weights, s.Len()), x0, layerOutput)
 }
 
-// objectiveR is like objective, but for RResults.
-func (g *GaussNewtonNN) objectiveR(delta ParamRDelta, s sgd.SampleSet) autofunc.RResult {
-	sampleIns, sampleOuts := joinSamples(s)
-	layerOutput := LinApproxR(g.Layers, delta, sampleIns, s.Len())
-	x0 := layerOutput.(*linearizerRResult).BatcherOutput.Output()
-	return QuadApproxR(g.outFunc(sampleOuts, s.Len()), x0, layerOutput)
+// normalizer returns the factor by which the total cost
+// of the sample set should be scaled.
+func (g *GaussNewtonNN) normalizer(s sgd.SampleSet) float64 {
+	if !g.Normalize {
+		return 1
+	}
+	return normalizer(s)
 }
 
-func (g *GaussNewtonNN) outFunc(expectedOuts linalg.Vector, n int) autofunc.RFunc {
+func (g *GaussNewtonNN) outFunc(expectedOuts, weights linalg.Vector, n int) autofunc.RFunc {
 	return &netOutFunc{
 		LastLayer:   g.Output,
 		CostFunc:    g.Cost,
 		SampleOuts:  expectedOuts,
+		Weights:     weights,
 		SampleCount: n,
 	}
 }
 
-func joinSamples(s sgd.SampleSet) (ins, outs linalg.Vector) {
+// joinSamples concatenates the inputs and outputs of the
+// samples in a sample set.
+// The weights are nil if every sample has a weight of 1.
+func joinSamples(s sgd.SampleSet) (ins, outs, weights linalg.Vector) {
 	if s.Len() == 0 {
 		return
 	}
 
-	sample := s.GetSample(0).(neuralnet.VectorSample)
+	sample := vectorSample(s.GetSample(0))
 	ins = make(linalg.Vector, len(sample.Input)*s.Len())
 	outs = make(linalg.Vector, len(sample.Output)*s.Len())
 	copy(ins, sample.Input)
 	copy(outs, sample.Output)
 
 	for i := 1; i < s.Len(); i++ {
-		sample = s.GetSample(i).(neuralnet.VectorSample)
+		sample = vectorSample(s.GetSample(i))
 		copy(ins[i*len(sample.Input):(i+1)*len(sample.Input)], sample.Input)
 		copy(outs[i*len(sample.Output):(i+1)*len(sample.Output)], sample.Output)
 	}
 
+	for i := 0; i < s.Len(); i++ {
+		if sampleWeight(s.GetSample(i)) != 1 {
+			weights = make(linalg.Vector, s.Len())
+			for j := range weights {
+				weights[j] = sampleWeight(s.GetSample(j))
+			}
+			break
+		}
+	}
+
 	return
 }
 
@@ -159,22 +235,54 @@ type netOutFunc struct {
 	CostFunc    neuralnet.CostFunc
 	SampleOuts  linalg.Vector
 	SampleCount int
+
+	// Weights, if non-nil, contains a weight for the cost
+	// of each sample.
+	Weights linalg.Vector
 }
 
 func (n *netOutFunc) Apply(in autofunc.Result) autofunc.Result {
 	if n.LastLayer != nil {
-		out1 := n.LastLayer.Batch(in, n.SampleCount)
-		return n.CostFunc.Cost(n.SampleOuts, out1)
-	} else {
+		in = n.LastLayer.Batch(in, n.SampleCount)
+	}
+	if n.Weights == nil {
 		return n.CostFunc.Cost(n.SampleOuts, in)
 	}
+	inSize := len(in.Output()) / n.SampleCount
+	outSize := len(n.SampleOuts) / n.SampleCount
+	var res autofunc.Result
+	for i, weight := range n.Weights {
+		sampleOut := autofunc.Slice(in, i*inSize, (i+1)*inSize)
+		expected := n.SampleOuts[i*outSize : (i+1)*outSize]
+		cost := autofunc.Scale(n.CostFunc.Cost(expected, sampleOut), weight)
+		if res == nil {
+			res = cost
+		} else {
+			res = autofunc.Add(res, cost)
+		}
+	}
+	return res
 }
 
 func (n *netOutFunc) ApplyR(v autofunc.RVector, in autofunc.RResult) autofunc.RResult {
 	if n.LastLayer != nil {
-		out1 := n.LastLayer.BatchR(v, in, n.SampleCount)
-		return n.CostFunc.CostR(v, n.SampleOuts, out1)
-	} else {
+		in = n.LastLayer.BatchR(v, in, n.SampleCount)
+	}
+	if n.Weights == nil {
 		return n.CostFunc.CostR(v, n.SampleOuts, in)
 	}
+	inSize := len(in.Output()) / n.SampleCount
+	outSize := len(n.SampleOuts) / n.SampleCount
+	var res autofunc.RResult
+	for i, weight := range n.Weights {
+		sampleOut := autofunc.SliceR(in, i*inSize, (i+1)*inSize)
+		expected := n.SampleOuts[i*outSize : (i+1)*outSize]
+		cost := autofunc.ScaleR(n.CostFunc.CostR(v, expected, sampleOut), weight)
+		if res == nil {
+			res = cost
+		} else {
+			res = autofunc.AddR(res, cost)
+		}
+	}
+	return res
 }
@@ -1,8 +1,11 @@
 package hessfree
 
 import (
+	"math"
+
 	"github.com/unixpickle/autofunc"
 	"github.com/unixpickle/num-analysis/linalg"
+	"gonum.org/v1/gonum/blas/blas64"
 )
 
 // A ParamDelta is a displacement vector (t - t0) where
@@ -75,42 +78,80 @@ func (c ConstParamDelta) addToVars() {
 	}
 }
 
-// magSquared returns the squared magnitude of the delta.
-func (c ConstParamDelta) magSquared() float64 {
-	return c.dot(c)
-}
-
-// dot returns the dot product of two deltas.
-func (c ConstParamDelta) dot(c1 ConstParamDelta) float64 {
+// Dot returns the dot product of two deltas.
+// Variables which are missing from c1 are treated as
+// zero vectors.
+func (c ConstParamDelta) Dot(c1 ConstParamDelta) float64 {
 	var res float64
 	for v, x := range c {
-		res += x.DotFast(c1[v])
+		if y, ok := c1[v]; ok {
+			res += blas64.Dot(blasVector(x), blasVector(y))
+		}
 	}
 	return res
 }
 
-// copy returns a copy of this delta.
-func (c ConstParamDelta) copy() ConstParamDelta {
-	res := ConstParamDelta{}
+// Norm returns the Euclidean norm of the delta.
+func (c ConstParamDelta) Norm() float64 {
+	return math.Sqrt(c.Dot(c))
+}
+
+// Axpy adds scaler*c1 to c in place.
+// Variables which are missing from c1 are left alone.
+func (c ConstParamDelta) Axpy(scaler float64, c1 ConstParamDelta) {
 	for v, x := range c {
-		res[v] = make(linalg.Vector, len(x))
-		copy(res[v], x)
+		if y, ok := c1[v]; ok {
+			blas64.Axpy(scaler, blasVector(y), blasVector(x))
+		}
 	}
-	return res
 }
 
-// scale scales the delta by the given scaler.
-func (c ConstParamDelta) scale(scaler float64) {
+// Scale scales the delta in place by the given scaler.
+func (c ConstParamDelta) Scale(scaler float64) {
 	for _, x := range c {
-		x.Scale(scaler)
+		blas64.Scal(scaler, blasVector(x))
 	}
 }
 
-// addDelta adds a scaled version of the given delta
-// to this delta.
-func (c ConstParamDelta) addDelta(c1 ConstParamDelta, scaler float64) {
-	// TODO: optimize this using BLAS.
+// CopyFrom copies the entries of c1 into c.
+// Variables which are missing from c1 are left alone.
+func (c ConstParamDelta) CopyFrom(c1 ConstParamDelta) {
 	for v, x := range c {
-		x.Add(c1[v].Copy().Scale(scaler))
+		if y, ok := c1[v]; ok {
+			blas64.Copy(blasVector(y), blasVector(x))
+		}
 	}
 }
+
+// Zero sets every entry of the delta to zero.
+func (c ConstParamDelta) Zero() {
+	for _, x := range c {
+		for i := range x {
+			x[i] = 0
+		}
+	}
+}
+
+// Clone returns a deep copy of the delta.
+func (c ConstParamDelta) Clone() ConstParamDelta {
+	res := make(ConstParamDelta, len(c))
+	for v, x := range c {
+		res[v] = make(linalg.Vector, len(x))
+		copy(res[v], x)
+	}
+	return res
+}
+
+// CloneShape returns a delta with the same variables and
+// vector lengths as c, but with every entry set to zero.
+func (c ConstParamDelta) CloneShape() ConstParamDelta {
+	res := make(ConstParamDelta, len(c))
+	for v, x := range c {
+		res[v] = make(linalg.Vector, len(x))
+	}
+	return res
+}
+
+func blasVector(v linalg.Vector) blas64.Vector {
+	return blas64.Vector{N: len(v), Data: v, Inc: 1}
+}
@@ -0,0 +1,116 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+const (
+	paramDeltaTestPrec = 1e-10
+	paramDeltaBenchVar = 100000
+)
+
+func TestConstParamDeltaArithmetic(t *testing.T) {
+	d1, d2 := paramDeltaTestDeltas(5)
+
+	var expectedDot float64
+	for v, x := range d1 {
+		for i, a := range x {
+			expectedDot += a * d2[v][i]
+		}
+	}
+	if actual := d1.Dot(d2); math.Abs(actual-expectedDot) > paramDeltaTestPrec {
+		t.Error("dot product should be", expectedDot, "but got", actual)
+	}
+	if actual := d1.Norm(); math.Abs(actual*actual-d1.Dot(d1)) > paramDeltaTestPrec {
+		t.Error("norm squared should be", d1.Dot(d1), "but got", actual*actual)
+	}
+
+	expected := d1.Clone()
+	for v, x := range expected {
+		for i := range x {
+			x[i] = 2*x[i] - 3*d2[v][i]
+		}
+	}
+	actual := d1.Clone()
+	actual.Scale(2)
+	actual.Axpy(-3, d2)
+	paramDeltaTestEquiv(t, actual, expected)
+
+	actual.CopyFrom(d2)
+	paramDeltaTestEquiv(t, actual, d2)
+
+	actual.Zero()
+	paramDeltaTestEquiv(t, actual, d1.CloneShape())
+	if actual.Norm() != 0 {
+		t.Error("expected zero norm")
+	}
+}
+
+func BenchmarkConstParamDeltaDot(b *testing.B) {
+	d1, d2 := paramDeltaTestDeltas(paramDeltaBenchVar)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d1.Dot(d2)
+	}
+}
+
+func BenchmarkConstParamDeltaAxpy(b *testing.B) {
+	d1, d2 := paramDeltaTestDeltas(paramDeltaBenchVar)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d1.Axpy(1e-5, d2)
+	}
+}
+
+func BenchmarkConstParamDeltaScale(b *testing.B) {
+	d1, _ := paramDeltaTestDeltas(paramDeltaBenchVar)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d1.Scale(1)
+	}
+}
+
+func BenchmarkConstParamDeltaCopyFrom(b *testing.B) {
+	d1, d2 := paramDeltaTestDeltas(paramDeltaBenchVar)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d1.CopyFrom(d2)
+	}
+}
+
+func paramDeltaTestDeltas(size int) (d1, d2 ConstParamDelta) {
+	d1 = ConstParamDelta{}
+	d2 = ConstParamDelta{}
+	for _, n := range []int{size, size / 2, 1} {
+		v := &autofunc.Variable{Vector: make(linalg.Vector, n)}
+		d1[v] = make(linalg.Vector, n)
+		d2[v] = make(linalg.Vector, n)
+		for i := 0; i < n; i++ {
+			d1[v][i] = rand.NormFloat64()
+			d2[v][i] = rand.NormFloat64()
+		}
+	}
+	return
+}
+
+func paramDeltaTestEquiv(t *testing.T, actual, expected ConstParamDelta) {
+	if len(actual) != len(expected) {
+		t.Fatal("expected", len(expected), "variables but got", len(actual))
+	}
+	for v, x := range expected {
+		a := actual[v]
+		if len(a) != len(x) {
+			t.Fatal("expected length", len(x), "but got", len(a))
+		}
+		for i, expVal := range x {
+			if math.Abs(a[i]-expVal) > paramDeltaTestPrec {
+				t.Fatal("entry", i, "should be", expVal, "but got", a[i])
+			}
+		}
+	}
+}
@@ -11,8 +11,13 @@ import (
 // function centered at x0 and evaluates the new
 // approximation at x.
 // The result becomes invalid if x0 is modified.
-// The given function must output a scaler, like
-// pretty much any loss function does.
+//
+// The function may have any number of outputs, in which
+// case each output component is approximated separately,
+// with its own gradient and Hessian.
+// Each component costs one extra back-propagation, so
+// scalar functions (like most loss functions) are the
+// cheapest to approximate.
 func QuadApprox(f autofunc.RFunc, x0 linalg.Vector, x autofunc.Result) autofunc.Result {
 	return &quadApproxResult{
 		lazyQuadApprox: lazyQuadApprox{
@@ -37,6 +42,10 @@ func QuadApproxR(f autofunc.RFunc, x0 linalg.Vector, x autofunc.RResult) autofun
 	}
 }
 
+// lazyQuadApprox computes the terms of a quadratic
+// approximation as they are needed.
+// Gradients and Hessian products are stored separately
+// for each output component.
 type lazyQuadApprox struct {
 	Lock sync.Mutex
 
@@ -47,14 +56,14 @@ type lazyQuadApprox struct {
 
 	Displacement linalg.Vector
 
-	EvalResult   autofunc.RResult
-	EvalHessProd linalg.Vector
-	EvalGrad     linalg.Vector
-	OutputVec    linalg.Vector
+	EvalResult    autofunc.RResult
+	EvalHessProds []linalg.Vector
+	EvalGrads     []linalg.Vector
+	OutputVec     linalg.Vector
 
-	REvalResult   autofunc.RResult
-	REvalHessProd linalg.Vector
-	ROutputVec    linalg.Vector
+	REvalResult    autofunc.RResult
+	REvalHessProds []linalg.Vector
+	ROutputVec     linalg.Vector
 }
 
 func (q *lazyQuadApprox) Output() linalg.Vector {
@@ -64,9 +73,13 @@ func (q *lazyQuadApprox) Output() linalg.Vector {
 		q.evaluate()
 	}
 	if q.OutputVec == nil {
-		hessDot := 0.5 * q.EvalHessProd.Dot(q.Displacement)
-		q.OutputVec = []float64{q.EvalResult.Output()[0] +
-			q.EvalResult.ROutput()[0] + hessDot}
+		outs := q.EvalResult.Output()
+		routs := q.EvalResult.ROutput()
+		q.OutputVec = make(linalg.Vector, len(outs))
+		for i, hessProd := range q.EvalHessProds {
+			hessDot := 0.5 * hessProd.Dot(q.Displacement)
+			q.OutputVec[i] = outs[i] + routs[i] + hessDot
+		}
 	}
 	return q.OutputVec
 }
@@ -81,8 +94,11 @@ func (q *lazyQuadApprox) ROutput() linalg.Vector {
 		if q.Displacement == nil {
 			q.computeDisplacement()
 		}
-		hessDot := q.Displacement.Dot(q.REvalHessProd)
-		q.ROutputVec = []float64{q.REvalResult.ROutput()[0] + hessDot}
+		routs := q.REvalResult.ROutput()
+		q.ROutputVec = make(linalg.Vector, len(routs))
+		for i, hessProd := range q.REvalHessProds {
+			q.ROutputVec[i] = routs[i] + q.Displacement.Dot(hessProd)
+		}
 	}
 	return q.ROutputVec
 }
@@ -98,17 +114,19 @@ func (q *lazyQuadApprox) evaluate() {
 	}
 	q.EvalResult = q.F.ApplyR(autofunc.RVector{}, inRVar)
 
-	if len(q.EvalResult.Output()) != 1 {
-		panic("QuadApprox only works with single-output functions")
-	}
+	outCount := len(q.EvalResult.Output())
+	q.EvalHessProds = make([]linalg.Vector, outCount)
+	q.EvalGrads = make([]linalg.Vector, outCount)
 
 	variables := []*autofunc.Variable{inVar}
-	grad := autofunc.NewGradient(variables)
-	rgrad := autofunc.NewRGradient(variables)
-	q.EvalResult.PropagateRGradient([]float64{1}, []float64{0}, rgrad, grad)
-
-	q.EvalHessProd = rgrad[inVar]
-	q.EvalGrad = grad[inVar]
+	for i := 0; i < outCount; i++ {
+		grad := autofunc.NewGradient(variables)
+		rgrad := autofunc.NewRGradient(variables)
+		upstream, upstreamR := basisUpstream(outCount, i)
+		q.EvalResult.PropagateRGradient(upstream, upstreamR, rgrad, grad)
+		q.EvalHessProds[i] = rgrad[inVar]
+		q.EvalGrads[i] = grad[inVar]
+	}
 }
 
 func (q *lazyQuadApprox) evaluateR() {
@@ -119,20 +137,58 @@ func (q *lazyQuadApprox) evaluateR() {
 	}
 	q.REvalResult = q.F.ApplyR(autofunc.RVector{}, inRVar)
 
-	if len(q.REvalResult.Output()) != 1 {
-		panic("QuadApprox only works with single-output functions")
-	}
+	outCount := len(q.REvalResult.Output())
+	q.REvalHessProds = make([]linalg.Vector, outCount)
 
 	variables := []*autofunc.Variable{inVar}
-	rgrad := autofunc.NewRGradient(variables)
-	q.REvalResult.PropagateRGradient([]float64{1}, []float64{0}, rgrad, nil)
-	q.REvalHessProd = rgrad[inVar]
+	for i := 0; i < outCount; i++ {
+		rgrad := autofunc.NewRGradient(variables)
+		upstream, upstreamR := basisUpstream(outCount, i)
+		q.REvalResult.PropagateRGradient(upstream, upstreamR, rgrad, nil)
+		q.REvalHessProds[i] = rgrad[inVar]
+	}
 }
 
 func (q *lazyQuadApprox) computeDisplacement() {
 	q.Displacement = q.X.Copy().Add(q.X0.Copy().Scale(-1))
 }
 
+// downstream computes the gradient of the approximation
+// with respect to its input, given the upstream vector.
+// The caller must hold the lock and have called evaluate.
+func (q *lazyQuadApprox) downstream(upstream linalg.Vector) linalg.Vector {
+	res := make(linalg.Vector, len(q.X0))
+	for i, u := range upstream {
+		if u != 0 {
+			res.Add(q.EvalGrads[i].Copy().Add(q.EvalHessProds[i]).Scale(u))
+		}
+	}
+	return res
+}
+
+// downstreamR computes the R-derivative of the gradient
+// of the approximation with respect to its input.
+// The caller must hold the lock and have called both
+// evaluate and evaluateR.
+func (q *lazyQuadApprox) downstreamR(upstream, upstreamR linalg.Vector) linalg.Vector {
+	res := q.downstream(upstreamR)
+	for i, u := range upstream {
+		if u != 0 {
+			res.Add(q.REvalHessProds[i].Copy().Scale(u))
+		}
+	}
+	return res
+}
+
+// basisUpstream creates upstream vectors for propagating
+// the gradient of a single output component.
+func basisUpstream(size, idx int) (upstream, upstreamR linalg.Vector) {
+	upstream = make(linalg.Vector, size)
+	upstream[idx] = 1
+	upstreamR = make(linalg.Vector, size)
+	return
+}
+
 type quadApproxResult struct {
 	lazyQuadApprox
 
@@ -151,7 +207,7 @@ func (q *quadApproxResult) PropagateGradient(upstream linalg.Vector, g autofunc.
 	if q.EvalResult == nil {
 		q.evaluate()
 	}
-	downstream := q.EvalGrad.Copy().Add(q.EvalHessProd).Scale(upstream[0])
+	downstream := q.downstream(upstream)
 	q.Lock.Unlock()
 	q.Input.PropagateGradient(downstream, g)
 }
@@ -182,10 +238,8 @@ func (q *quadApproxRResult) PropagateRGradient(upstream, upstreamR linalg.Vector
 	if q.REvalResult == nil {
 		q.evaluateR()
 	}
-	rawGradient := q.EvalGrad.Copy().Add(q.EvalHessProd)
-	downstream := rawGradient.Copy().Scale(upstream[0])
-	gradDeriv := q.REvalHessProd.Copy()
-	downstreamR := rawGradient.Scale(upstreamR[0]).Add(gradDeriv.Scale(upstream[0]))
+	downstream := q.downstream(upstream)
+	downstreamR := q.downstreamR(upstream, upstreamR)
 	q.Lock.Unlock()
 	q.Input.PropagateRGradient(downstream, downstreamR, rg, g)
 }
@@ -223,9 +277,7 @@ func (q *quadApproxRResult) optimizedProp(upstream, upstreamR linalg.Vector,
 	if q.REvalResult == nil {
 		q.evaluateR()
 	}
-	rawGradient := q.EvalGrad.Copy().Add(q.EvalHessProd)
-	gradDeriv := q.REvalHessProd.Copy()
-	downstreamR := rawGradient.Scale(upstreamR[0]).Add(gradDeriv.Scale(upstream[0]))
+	downstreamR := q.downstreamR(upstream, upstreamR)
 	q.Lock.Unlock()
 	q.Input.(*linearizerRResult).OptimizedBackprop(downstreamR, rg)
 }
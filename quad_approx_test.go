@@ -115,6 +115,67 @@ func TestQuadApproxRGradient(t *testing.T) {
 	}
 }
 
+func TestQuadApproxMultiOutput(t *testing.T) {
+	inputVec := &autofunc.Variable{Vector: []float64{-0.383238, 0.945592}}
+	inputRVec := &autofunc.RVariable{
+		Variable:   inputVec,
+		ROutputVec: []float64{0.23427, -0.57973},
+	}
+	centerVec := linalg.Vector{0.77892, 0.57992}
+	upstream := []float64{0.61045, -0.2314}
+	upstreamR := []float64{-0.31045, 0.7131}
+
+	actual := QuadApproxR(quadApproxTestMultiFunc{}, centerVec, inputRVec)
+	actualGrad := autofunc.NewGradient([]*autofunc.Variable{inputVec})
+	actualRGrad := autofunc.NewRGradient([]*autofunc.Variable{inputVec})
+	actual.PropagateRGradient(append([]float64{}, upstream...),
+		append([]float64{}, upstreamR...), actualRGrad, actualGrad)
+
+	actualNonR := QuadApprox(quadApproxTestMultiFunc{}, centerVec, inputVec)
+	actualNonRGrad := autofunc.NewGradient([]*autofunc.Variable{inputVec})
+	actualNonR.PropagateGradient(append([]float64{}, upstream...), actualNonRGrad)
+
+	if len(actual.Output()) != 2 || len(actualNonR.Output()) != 2 {
+		t.Fatal("expected two outputs")
+	}
+
+	expectedGrad := autofunc.NewGradient([]*autofunc.Variable{inputVec})
+	expectedRGrad := autofunc.NewRGradient([]*autofunc.Variable{inputVec})
+	for i := 0; i < 2; i++ {
+		component := quadApproxTestComponent{Index: i}
+		expected := QuadApproxR(component, centerVec, inputRVec)
+		if math.Abs(expected.Output()[0]-actual.Output()[i]) > quadApproxTestPrec {
+			t.Error("output", i, "should be", expected.Output()[0], "but got",
+				actual.Output()[i])
+		}
+		if math.Abs(expected.Output()[0]-actualNonR.Output()[i]) > quadApproxTestPrec {
+			t.Error("non-R output", i, "should be", expected.Output()[0], "but got",
+				actualNonR.Output()[i])
+		}
+		if math.Abs(expected.ROutput()[0]-actual.ROutput()[i]) > quadApproxTestPrec {
+			t.Error("r-output", i, "should be", expected.ROutput()[0], "but got",
+				actual.ROutput()[i])
+		}
+		expected.PropagateRGradient([]float64{upstream[i]}, []float64{upstreamR[i]},
+			expectedRGrad, expectedGrad)
+	}
+
+	for _, grad := range []autofunc.Gradient{actualGrad, actualNonRGrad} {
+		for i, x := range expectedGrad[inputVec] {
+			a := grad[inputVec][i]
+			if math.Abs(x-a) > quadApproxTestPrec {
+				t.Error("expected partial", i, "to be", x, "but it's", a)
+			}
+		}
+	}
+	for i, x := range expectedRGrad[inputVec] {
+		a := actualRGrad[inputVec][i]
+		if math.Abs(x-a) > quadApproxTestPrec {
+			t.Error("expected r-partial", i, "to be", x, "but it's", a)
+		}
+	}
+}
+
 type quadApproxTestFunc struct{}
 
 func (_ quadApproxTestFunc) Apply(in autofunc.Result) autofunc.Result {
@@ -188,3 +249,39 @@ func quadApproxTestTermsR(center linalg.Vector) (bias, grad *autofunc.RVariable,
 	grad = autofunc.NewRVariable(gradVar, autofunc.RVector{})
 	return
 }
+
+// quadApproxTestMultiFunc outputs the value of
+// quadApproxTestFunc along with a second function.
+type quadApproxTestMultiFunc struct{}
+
+func (_ quadApproxTestMultiFunc) Apply(in autofunc.Result) autofunc.Result {
+	x := autofunc.Slice(in, 0, 1)
+	y := autofunc.Slice(in, 1, 2)
+	second := autofunc.Mul(autofunc.Pow(x, 2), autofunc.Sin{}.Apply(y))
+	return autofunc.Concat(quadApproxTestFunc{}.Apply(in), second)
+}
+
+func (_ quadApproxTestMultiFunc) ApplyR(v autofunc.RVector,
+	in autofunc.RResult) autofunc.RResult {
+	x := autofunc.SliceR(in, 0, 1)
+	y := autofunc.SliceR(in, 1, 2)
+	second := autofunc.MulR(autofunc.PowR(x, 2), autofunc.Sin{}.ApplyR(v, y))
+	return autofunc.ConcatR(quadApproxTestFunc{}.ApplyR(v, in), second)
+}
+
+// quadApproxTestComponent is a single output component of
+// quadApproxTestMultiFunc.
+type quadApproxTestComponent struct {
+	Index int
+}
+
+func (q quadApproxTestComponent) Apply(in autofunc.Result) autofunc.Result {
+	out := quadApproxTestMultiFunc{}.Apply(in)
+	return autofunc.Slice(out, q.Index, q.Index+1)
+}
+
+func (q quadApproxTestComponent) ApplyR(v autofunc.RVector,
+	in autofunc.RResult) autofunc.RResult {
+	out := quadApproxTestMultiFunc{}.ApplyR(v, in)
+	return autofunc.SliceR(out, q.Index, q.Index+1)
+}
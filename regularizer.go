@@ -0,0 +1,256 @@
+package hessfree
+
+import (
+	"sync"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/sgd"
+)
+
+// A Regularizer is a twice-differentiable penalty on the
+// values of a set of parameters.
+//
+// The values passed to a Regularizer map each variable
+// to its (possibly hypothetical) value.
+// Variables which are missing from a direction or value
+// should be treated as zero.
+// Implementations should not modify their arguments.
+type Regularizer interface {
+	// Penalty evaluates the penalty.
+	Penalty(values ConstParamDelta) float64
+
+	// Gradient computes the gradient of the penalty with
+	// respect to every variable in values.
+	Gradient(values ConstParamDelta) ConstParamDelta
+
+	// HessianProduct applies the Hessian of the penalty,
+	// evaluated at values, to the direction v.
+	// The result should contain every variable in v.
+	HessianProduct(values, v ConstParamDelta) ConstParamDelta
+}
+
+// L2Regularizer is a Regularizer which penalizes the
+// squared magnitudes of parameters, i.e. weight decay.
+// The penalty for each variable is (c/2)*||w||^2, where c
+// is the variable's coefficient.
+type L2Regularizer struct {
+	// Coeff is the coefficient for variables which are not
+	// in Coeffs.
+	Coeff float64
+
+	// Coeffs optionally maps variables to their own
+	// coefficients.
+	Coeffs map[*autofunc.Variable]float64
+}
+
+func (l *L2Regularizer) Penalty(values ConstParamDelta) float64 {
+	var res float64
+	for variable, vec := range values {
+		res += l.coeff(variable) * vec.Dot(vec) / 2
+	}
+	return res
+}
+
+func (l *L2Regularizer) Gradient(values ConstParamDelta) ConstParamDelta {
+	res := ConstParamDelta{}
+	for variable, vec := range values {
+		res[variable] = vec.Copy().Scale(l.coeff(variable))
+	}
+	return res
+}
+
+func (l *L2Regularizer) HessianProduct(values, v ConstParamDelta) ConstParamDelta {
+	res := ConstParamDelta{}
+	for variable, vec := range v {
+		res[variable] = vec.Copy().Scale(l.coeff(variable))
+	}
+	return res
+}
+
+func (l *L2Regularizer) coeff(v *autofunc.Variable) float64 {
+	if c, ok := l.Coeffs[v]; ok {
+		return c
+	}
+	return l.Coeff
+}
+
+// A RegularizedObjective adds a Regularizer's penalty to
+// a wrapped Objective.
+//
+// The penalty is evaluated at the current parameters plus
+// the delta.
+// In the quadratic approximation, the penalty is replaced
+// by its second-order Taylor expansion around the current
+// parameters.
+//
+// Like the damping term of a DampingLearner, the penalty
+// is multiplied by the number of samples (or the total
+// weight of the samples) in each sample set, since it is
+// assumed that the total cost is the sum of the costs for
+// each sample.
+// If the wrapped objective is normalized (see Normalizer),
+// the penalty is not multiplied.
+type RegularizedObjective struct {
+	Wrapped     Objective
+	Regularizer Regularizer
+
+	// Params are the variables which are penalized.
+	Params []*autofunc.Variable
+
+	centerOnce    sync.Once
+	centerValues  ConstParamDelta
+	centerPenalty float64
+	centerGrad    ConstParamDelta
+}
+
+func (r *RegularizedObjective) Quad(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	return r.Wrapped.Quad(delta, s) + r.quadPenalty(delta, s)
+}
+
+func (r *RegularizedObjective) QuadGrad(delta ConstParamDelta, s sgd.SampleSet) ConstParamDelta {
+	res := r.Wrapped.QuadGrad(delta, s)
+	r.computeCenter()
+	scaler := r.sampleScale(s)
+	product := r.Regularizer.HessianProduct(r.centerValues, r.restrict(delta))
+	for variable, resVec := range res {
+		if gradVec, ok := r.centerGrad[variable]; ok {
+			resVec.Add(gradVec.Copy().Scale(scaler))
+		}
+		if prodVec, ok := product[variable]; ok {
+			resVec.Add(prodVec.Copy().Scale(scaler))
+		}
+	}
+	return res
+}
+
+func (r *RegularizedObjective) QuadHessian(delta, x ConstParamDelta,
+	s sgd.SampleSet) (ConstParamDelta, float64) {
+	res, val := r.Wrapped.QuadHessian(delta, x, s)
+	r.computeCenter()
+	scaler := r.sampleScale(s)
+	product := r.Regularizer.HessianProduct(r.centerValues, r.restrict(delta))
+	for variable, resVec := range res {
+		if prodVec, ok := product[variable]; ok {
+			resVec.Add(prodVec.Copy().Scale(scaler))
+		}
+	}
+	return res, val + r.quadPenalty(x, s)
+}
+
+func (r *RegularizedObjective) Objective(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	return r.Wrapped.Objective(delta, s) + r.sampleScale(s)*r.penalty(delta)
+}
+
+// penalty evaluates the exact, unscaled penalty at the
+// given delta.
+func (r *RegularizedObjective) penalty(delta ConstParamDelta) float64 {
+	values := ConstParamDelta{}
+	for _, param := range r.Params {
+		if d, ok := delta[param]; ok {
+			values[param] = param.Vector.Copy().Add(d)
+		} else {
+			values[param] = param.Vector
+		}
+	}
+	return r.Regularizer.Penalty(values)
+}
+
+// quadPenalty evaluates the second-order approximation of
+// the scaled penalty at the given delta.
+func (r *RegularizedObjective) quadPenalty(delta ConstParamDelta, s sgd.SampleSet) float64 {
+	r.computeCenter()
+	restricted := r.restrict(delta)
+	product := r.Regularizer.HessianProduct(r.centerValues, restricted)
+	res := r.centerPenalty
+	for variable, vec := range restricted {
+		res += r.centerGrad[variable].Dot(vec) + product[variable].Dot(vec)/2
+	}
+	return r.sampleScale(s) * res
+}
+
+// Normalized checks if the wrapped objective is
+// normalized.
+func (r *RegularizedObjective) Normalized() bool {
+	return isNormalized(r.Wrapped)
+}
+
+// sampleScale returns the factor by which the penalty is
+// scaled for the sample set.
+func (r *RegularizedObjective) sampleScale(s sgd.SampleSet) float64 {
+	return sampleScale(r.Normalized(), s)
+}
+
+// restrict creates a version of delta which only contains
+// penalized variables.
+func (r *RegularizedObjective) restrict(delta ConstParamDelta) ConstParamDelta {
+	res := ConstParamDelta{}
+	for _, param := range r.Params {
+		if vec, ok := delta[param]; ok {
+			res[param] = vec
+		}
+	}
+	return res
+}
+
+// computeCenter evaluates the penalty and its gradient at
+// the current parameters, if it has not done so already.
+func (r *RegularizedObjective) computeCenter() {
+	r.centerOnce.Do(func() {
+		r.centerValues = ConstParamDelta{}
+		for _, param := range r.Params {
+			r.centerValues[param] = param.Vector.Copy()
+		}
+		r.centerPenalty = r.Regularizer.Penalty(r.centerValues)
+		r.centerGrad = r.Regularizer.Gradient(r.centerValues)
+	})
+}
+
+// A RegularizedLearner wraps a Learner and regularizes
+// the objectives it creates.
+type RegularizedLearner struct {
+	WrappedLearner Learner
+	Regularizer    Regularizer
+
+	// Params are the variables which are penalized.
+	// If this is nil, all of the wrapped learner's
+	// parameters are penalized.
+	Params []*autofunc.Variable
+}
+
+func (r *RegularizedLearner) Parameters() []*autofunc.Variable {
+	return r.WrappedLearner.Parameters()
+}
+
+// Normalized checks if the wrapped learner is normalized.
+func (r *RegularizedLearner) Normalized() bool {
+	return isNormalized(r.WrappedLearner)
+}
+
+// MakeObjective creates a RegularizedObjective which
+// wraps the wrapped learner's objective.
+func (r *RegularizedLearner) MakeObjective() Objective {
+	return r.objective(r.WrappedLearner.MakeObjective())
+}
+
+// Evaluate evaluates the wrapped learner and adds the
+// penalty for the current parameters.
+func (r *RegularizedLearner) Evaluate(s sgd.SampleSet) float64 {
+	scale := sampleScale(r.Normalized(), s)
+	return evaluate(r.WrappedLearner, s) + scale*r.objective(nil).penalty(ConstParamDelta{})
+}
+
+func (r *RegularizedLearner) Adjust(delta, quadMin ConstParamDelta, s sgd.SampleSet) {
+	r.WrappedLearner.Adjust(delta, quadMin, s)
+}
+
+func (r *RegularizedLearner) objective(wrapped Objective) *RegularizedObjective {
+	params := r.Params
+	if params == nil {
+		params = r.WrappedLearner.Parameters()
+	}
+	return &RegularizedObjective{
+		Wrapped:     wrapped,
+		Regularizer: r.Regularizer,
+		Params:      params,
+	}
+}
@@ -0,0 +1,87 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestRegularizedLearner(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  30,
+			OutputCount: 20,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  20,
+			OutputCount: 30,
+		},
+	}
+	network.Randomize()
+
+	params := network.Parameters()
+	regularizer := &L2Regularizer{
+		Coeff:  0.1,
+		Coeffs: map[*autofunc.Variable]float64{params[1]: 0},
+	}
+	learner := &DampingLearner{
+		WrappedLearner: &RegularizedLearner{
+			WrappedLearner: &NeuralNetLearner{
+				Layers:         network,
+				Cost:           neuralnet.SigmoidCECost{},
+				MaxSubBatch:    10,
+				MaxConcurrency: 1,
+			},
+			Regularizer: regularizer,
+		},
+		DampingCoeff: 1,
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 50; i++ {
+		vec := make(linalg.Vector, 30)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	sampleSet := neuralnet.VectorSampleSet(inputs, inputs)
+
+	testLearner(t, learner, sampleSet)
+
+	objective := learner.MakeObjective()
+	regularized := objective.(*dampedObjective).WrappedObjective.(*RegularizedObjective)
+	unregularized := regularized.Wrapped
+
+	delta := ConstParamDelta{}
+	var expectedPenalty float64
+	for _, param := range params {
+		vec := make(linalg.Vector, len(param.Vector))
+		for i := range vec {
+			vec[i] = rand.NormFloat64() * learnerTestOffset
+		}
+		delta[param] = vec
+		if param != params[1] {
+			sum := param.Vector.Copy().Add(vec)
+			expectedPenalty += 0.05 * sum.Dot(sum)
+		}
+	}
+	expectedPenalty *= float64(sampleSet.Len())
+
+	actual := regularized.Objective(delta, sampleSet) -
+		unregularized.Objective(delta, sampleSet)
+	if math.Abs(actual-expectedPenalty) > learnerTestPrec {
+		t.Error("expected penalty", expectedPenalty, "but got", actual)
+	}
+
+	// The L2 penalty is quadratic, so its approximation is exact.
+	actual = regularized.Quad(delta, sampleSet) - unregularized.Quad(delta, sampleSet)
+	if math.Abs(actual-expectedPenalty) > learnerTestPrec {
+		t.Error("expected quadratic penalty", expectedPenalty, "but got", actual)
+	}
+}
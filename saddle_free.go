@@ -0,0 +1,168 @@
+package hessfree
+
+import (
+	"math"
+	"time"
+
+	"github.com/unixpickle/sgd"
+)
+
+const (
+	defaultSaddleFreeKrylovDim     = 20
+	defaultSaddleFreeMinCurvature  = 1e-4
+	defaultSaddleFreeMaxBacktracks = 5
+)
+
+// SaddleFreeSolver is a Solver which implements the
+// saddle-free Newton method from Dauphin et al. (2014).
+//
+// It builds a Krylov subspace using the Lanczos algorithm
+// on the QuadHessian operator, starting from the gradient.
+// In this subspace, it replaces the curvature matrix H by
+// |H| (i.e. it takes the absolute values of the
+// eigenvalues), so that directions of negative curvature
+// are followed downhill rather than towards a saddle
+// point.
+// The resulting step is then shrunk until it reduces the
+// true objective.
+//
+// Unlike CGSolver, this does not use warm starts.
+// Since the step does not minimize the quadratic
+// approximation, the QuadMin of each result is the
+// accepted step, which is the same as Delta.
+// During backtracking, LogCGIteration receives the step's
+// scale and its true objective value.
+// The UI's ShouldStop is checked between Lanczos
+// iterations and between backtracking steps.
+// If the UI is an EventUI, the Lanczos products are timed
+// as TimingQuadHessian, like the products in CG.
+type SaddleFreeSolver struct {
+	// KrylovDim is the maximum dimension of the Krylov
+	// subspace.
+	// If this is 0, a reasonable default is used.
+	KrylovDim int
+
+	// MinCurvature is the smallest absolute eigenvalue to
+	// use, relative to the largest absolute eigenvalue.
+	// Smaller eigenvalues are raised to this value to avoid
+	// huge steps.
+	// If this is 0, a reasonable default is used.
+	MinCurvature float64
+
+	// MaxBacktracks is the maximum number of times the step
+	// is halved while looking for a decrease in the true
+	// objective.
+	// If this is 0, a reasonable default is used.
+	MaxBacktracks int
+}
+
+// Solve computes a saddle-free Newton step.
+func (s *SaddleFreeSolver) Solve(t *Trainer, obj Objective, samples sgd.SampleSet,
+	start ConstParamDelta) *SolverResult {
+	layout := NewParamLayout(t.Learner.Parameters())
+	zero := layout.Unflatten(make([]float64, layout.Len()))
+
+	startObjective := obj.Objective(ConstParamDelta{}, samples)
+	grad := obj.QuadGrad(zero, samples)
+	gradMag := grad.Norm()
+	t.UI.LogCGStart(obj.Quad(zero, samples), startObjective)
+
+	result := &SolverResult{
+		Delta:   zero,
+		QuadMin: zero,
+		Value:   startObjective,
+	}
+	if gradMag == 0 {
+		return result
+	}
+
+	var quadObj QuadObjective = obj
+	if events, ok := t.UI.(EventUI); ok {
+		quadObj = &timedQuadObjective{QuadObjective: obj, Events: events}
+	}
+	krylov, stopped := lanczos(quadObj, layout, samples, grad, s.krylovDim(),
+		t.UI.ShouldStop)
+	if stopped {
+		return &SolverResult{Stopped: true}
+	}
+	result.Iterations = len(krylov.Alpha)
+
+	var maxAbs float64
+	for _, x := range krylov.RitzValues {
+		maxAbs = math.Max(maxAbs, math.Abs(x))
+	}
+	if maxAbs == 0 {
+		return result
+	}
+	minAbs := s.minCurvature() * maxAbs
+
+	// The gradient is the first Lanczos vector, scaled by
+	// gradMag, so its coordinates in the eigenbasis of T
+	// are gradMag times the first entries of the
+	// eigenvectors of T.
+	step := zero.CloneShape()
+	for i, value := range krylov.RitzValues {
+		coord := gradMag * krylov.tridiagVectors.Get(0, i)
+		step.Axpy(-coord/math.Max(math.Abs(value), minAbs), krylov.RitzVectors[i])
+	}
+
+	events, _ := t.UI.(EventUI)
+	scale := 1.0
+	for i := 0; i <= s.maxBacktracks(); i++ {
+		candidate := step.Clone()
+		candidate.Scale(scale)
+		value := obj.Objective(candidate, samples)
+		t.UI.LogCGIteration(scale, value)
+		if events != nil {
+			events.LogBacktrack(i, value)
+		}
+		if value < result.Value {
+			result.Delta = candidate
+			result.QuadMin = candidate
+			result.Value = value
+			break
+		}
+		if t.UI.ShouldStop() {
+			return &SolverResult{Stopped: true}
+		}
+		scale /= 2
+	}
+
+	return result
+}
+
+func (s *SaddleFreeSolver) krylovDim() int {
+	if s.KrylovDim == 0 {
+		return defaultSaddleFreeKrylovDim
+	}
+	return s.KrylovDim
+}
+
+func (s *SaddleFreeSolver) minCurvature() float64 {
+	if s.MinCurvature == 0 {
+		return defaultSaddleFreeMinCurvature
+	}
+	return s.MinCurvature
+}
+
+func (s *SaddleFreeSolver) maxBacktracks() int {
+	if s.MaxBacktracks == 0 {
+		return defaultSaddleFreeMaxBacktracks
+	}
+	return s.MaxBacktracks
+}
+
+// timedQuadObjective reports the time spent in every
+// QuadHessian call as TimingQuadHessian.
+type timedQuadObjective struct {
+	QuadObjective
+	Events EventUI
+}
+
+func (t *timedQuadObjective) QuadHessian(delta, x ConstParamDelta,
+	s sgd.SampleSet) (ConstParamDelta, float64) {
+	start := time.Now()
+	product, value := t.QuadObjective.QuadHessian(delta, x, s)
+	t.Events.LogTiming(TimingQuadHessian, time.Since(start))
+	return product, value
+}
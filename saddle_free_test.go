@@ -0,0 +1,147 @@
+package hessfree
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+)
+
+func TestSaddleFreeSolver(t *testing.T) {
+	param := &autofunc.Variable{Vector: []float64{0, 0}}
+	obj := &saddleTestObjective{
+		Param:     param,
+		Curvature: linalg.Vector{2, -1},
+		Gradient:  linalg.Vector{1, 1},
+	}
+	trainer := &Trainer{
+		Learner: &paramsLearner{[]*autofunc.Variable{param}},
+		UI:      nopUI{},
+	}
+	solver := &SaddleFreeSolver{KrylovDim: 2}
+	result := solver.Solve(trainer, obj, sgd.SliceSampleSet{nil}, nil)
+
+	// A Newton step would go to the saddle point at
+	// (-0.5, 1), increasing the objective.
+	expected := []float64{-0.5, -1}
+	for i, x := range expected {
+		if math.Abs(result.Delta[param][i]-x) > 1e-8 {
+			t.Errorf("entry %d should be %f but got %f", i, x, result.Delta[param][i])
+		}
+	}
+	if math.Abs(result.Value-(-1.75)) > 1e-8 {
+		t.Error("unexpected objective value", result.Value)
+	}
+	for i, x := range result.Delta[param] {
+		if result.QuadMin[param][i] != x {
+			t.Error("QuadMin should be the accepted step but got", result.QuadMin[param])
+			break
+		}
+	}
+}
+
+func TestSaddleFreeSolverStop(t *testing.T) {
+	param := &autofunc.Variable{Vector: []float64{0, 0}}
+	obj := &saddleTestObjective{
+		Param:     param,
+		Curvature: linalg.Vector{2, -1},
+		Gradient:  linalg.Vector{1, 1},
+	}
+	trainer := &Trainer{
+		Learner: &paramsLearner{[]*autofunc.Variable{param}},
+		UI:      &recordingUI{},
+	}
+	result := (&SaddleFreeSolver{}).Solve(trainer, obj, sgd.SliceSampleSet{nil}, nil)
+	if !result.Stopped {
+		t.Error("expected solver to stop")
+	}
+	if obj.HessianCalls != 0 {
+		t.Error("expected no Lanczos iterations but got", obj.HessianCalls)
+	}
+}
+
+func TestTrainerSaddleFree(t *testing.T) {
+	learner, samples := trainerTestLearner()
+	objective := learner.MakeObjective()
+	initial := objective.Objective(ConstParamDelta{}, samples)
+
+	ui := &recordingUI{stopEpoch: 2}
+	trainer := &Trainer{
+		Learner:   learner,
+		Samples:   samples,
+		BatchSize: 10,
+		UI:        ui,
+		Solver:    &SaddleFreeSolver{KrylovDim: 3},
+	}
+	trainer.Train()
+
+	if ui.solves == 0 || ui.updates != ui.solves {
+		t.Errorf("expected one update per solve but got %d solves and %d updates",
+			ui.solves, ui.updates)
+	}
+	if ui.maxIterations > 3 {
+		t.Error("expected at most 3 Lanczos iterations but got", ui.maxIterations)
+	}
+	if ui.timings[TimingQuadHessian] < ui.solves {
+		t.Errorf("expected Lanczos products to be timed but got %d timings for %d solves",
+			ui.timings[TimingQuadHessian], ui.solves)
+	}
+	// The saddle-free solver logs one CG iteration per
+	// backtracking step, unlike CGSolver.
+	if ui.backtracks == 0 || ui.cgIterations != ui.backtracks {
+		t.Errorf("expected one CG iteration per backtrack but got %d and %d",
+			ui.cgIterations, ui.backtracks)
+	}
+
+	final := learner.MakeObjective().Objective(ConstParamDelta{}, samples)
+	if final >= initial {
+		t.Error("objective did not decrease:", initial, "to", final)
+	}
+}
+
+// saddleTestObjective is an exact quadratic with a
+// diagonal curvature matrix.
+type saddleTestObjective struct {
+	Param     *autofunc.Variable
+	Curvature linalg.Vector
+	Gradient  linalg.Vector
+
+	HessianCalls int
+}
+
+func (s *saddleTestObjective) Quad(delta ConstParamDelta, samples sgd.SampleSet) float64 {
+	d := delta[s.Param]
+	if d == nil {
+		return 0
+	}
+	var res float64
+	for i, x := range d {
+		res += s.Gradient[i]*x + 0.5*s.Curvature[i]*x*x
+	}
+	return res
+}
+
+func (s *saddleTestObjective) QuadGrad(delta ConstParamDelta,
+	samples sgd.SampleSet) ConstParamDelta {
+	res := make(linalg.Vector, len(s.Gradient))
+	for i, x := range delta[s.Param] {
+		res[i] = s.Gradient[i] + s.Curvature[i]*x
+	}
+	return ConstParamDelta{s.Param: res}
+}
+
+func (s *saddleTestObjective) QuadHessian(delta, x ConstParamDelta,
+	samples sgd.SampleSet) (ConstParamDelta, float64) {
+	s.HessianCalls++
+	res := make(linalg.Vector, len(s.Gradient))
+	for i, y := range delta[s.Param] {
+		res[i] = s.Curvature[i] * y
+	}
+	return ConstParamDelta{s.Param: res}, s.Quad(x, samples)
+}
+
+func (s *saddleTestObjective) Objective(delta ConstParamDelta, samples sgd.SampleSet) float64 {
+	return s.Quad(delta, samples)
+}
@@ -0,0 +1,50 @@
+package hessfree
+
+import (
+	"reflect"
+
+	"github.com/unixpickle/sgd"
+)
+
+// A sampleSetKey identifies a sample set, so that values
+// computed for it can be cached.
+//
+// Sample sets backed by slices (like sgd.SliceSampleSet)
+// are identified by their type, backing array, and length,
+// so a subset and a copy of the same samples are different
+// sets.
+// Sample sets which are pointers are identified by their
+// type, address, and length, so two calls to Subset that
+// each allocate a new set give different keys.
+// Other sample sets are identified by their values, which
+// must be comparable.
+type sampleSetKey struct {
+	setType reflect.Type
+	value   interface{}
+	length  int
+}
+
+// newSampleSetKey creates the key for a sample set.
+// The second return value is false if the set cannot be
+// identified, in which case nothing should be cached for
+// it.
+//
+// Caches must keep a reference to the sample set for as
+// long as the key is stored, so that the memory of the
+// set cannot be reused by a different set.
+func newSampleSetKey(s sgd.SampleSet) (sampleSetKey, bool) {
+	val := reflect.ValueOf(s)
+	key := sampleSetKey{setType: val.Type(), length: s.Len()}
+	switch val.Kind() {
+	case reflect.Slice:
+		key.value = val.Pointer()
+	case reflect.Ptr:
+		key.value = val.Pointer()
+	default:
+		if !val.Type().Comparable() {
+			return sampleSetKey{}, false
+		}
+		key.value = s
+	}
+	return key, true
+}
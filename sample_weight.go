@@ -0,0 +1,96 @@
+package hessfree
+
+import (
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+// A WeightedSample is a neuralnet.VectorSample whose cost
+// is multiplied by a weight.
+//
+// Weights are applied consistently to the cost, its
+// gradient, the Gauss-Newton products, and the damping,
+// where the sum of the weights in a sample set replaces
+// the number of samples.
+type WeightedSample struct {
+	neuralnet.VectorSample
+	Weight float64
+}
+
+// SampleWeight returns the weight of the sample.
+func (w WeightedSample) SampleWeight() float64 {
+	return w.Weight
+}
+
+// WeightedSampleSet creates a sample set of
+// WeightedSamples.
+func WeightedSampleSet(ins, outs []linalg.Vector, weights []float64) sgd.SampleSet {
+	if len(ins) != len(outs) || len(ins) != len(weights) {
+		panic("input, output, and weight counts must match")
+	}
+	res := make(sgd.SliceSampleSet, len(ins))
+	for i, in := range ins {
+		res[i] = WeightedSample{
+			VectorSample: neuralnet.VectorSample{
+				Input:  in,
+				Output: outs[i],
+			},
+			Weight: weights[i],
+		}
+	}
+	return res
+}
+
+// sampleWeight returns the weight of a sample, which is 1
+// for samples without a SampleWeight method.
+func sampleWeight(sample interface{}) float64 {
+	if w, ok := sample.(interface {
+		SampleWeight() float64
+	}); ok {
+		return w.SampleWeight()
+	}
+	return 1
+}
+
+// totalWeight returns the sum of the weights of the
+// samples in a sample set.
+// For unweighted samples, this is the number of samples.
+func totalWeight(s sgd.SampleSet) float64 {
+	var res float64
+	for i := 0; i < s.Len(); i++ {
+		res += sampleWeight(s.GetSample(i))
+	}
+	return res
+}
+
+// vectorSample extracts the neuralnet.VectorSample from a
+// sample which may or may not be weighted.
+func vectorSample(sample interface{}) neuralnet.VectorSample {
+	if w, ok := sample.(WeightedSample); ok {
+		return w.VectorSample
+	}
+	return sample.(neuralnet.VectorSample)
+}
+
+// normalizer returns the factor which turns a sum over the
+// sample set into a (weighted) mean.
+// For empty sample sets, or sample sets with no weight,
+// the factor is 1.
+func normalizer(s sgd.SampleSet) float64 {
+	weight := totalWeight(s)
+	if weight == 0 {
+		return 1
+	}
+	return 1 / weight
+}
+
+// sampleScale returns the factor by which per-sample
+// terms (like damping) should be multiplied for a sample
+// set, depending on whether the objective is normalized.
+func sampleScale(normalized bool, s sgd.SampleSet) float64 {
+	if normalized {
+		return 1
+	}
+	return totalWeight(s)
+}
@@ -0,0 +1,98 @@
+package hessfree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestWeightedSamples(t *testing.T) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  10,
+			OutputCount: 5,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  5,
+			OutputCount: 10,
+		},
+	}
+	network.Randomize()
+
+	learner := &DampingLearner{
+		WrappedLearner: &NeuralNetLearner{
+			Layers:         network,
+			Cost:           neuralnet.SigmoidCECost{},
+			MaxSubBatch:    3,
+			MaxConcurrency: 2,
+		},
+		DampingCoeff: 0.5,
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 6; i++ {
+		vec := make(linalg.Vector, 10)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+
+	// Weights of 2 and 0 are equivalent to duplicating and
+	// removing samples, respectively.
+	weights := []float64{1, 2, 0, 1, 2, 1}
+	weighted := WeightedSampleSet(inputs, inputs, weights)
+	var expanded []linalg.Vector
+	for i, w := range weights {
+		for j := 0; j < int(w); j++ {
+			expanded = append(expanded, inputs[i])
+		}
+	}
+	unweighted := neuralnet.VectorSampleSet(expanded, expanded)
+
+	if totalWeight(weighted) != float64(unweighted.Len()) {
+		t.Fatal("unexpected total weight", totalWeight(weighted))
+	}
+
+	delta := ConstParamDelta{}
+	x := ConstParamDelta{}
+	for _, v := range learner.Parameters() {
+		delta[v] = make(linalg.Vector, len(v.Vector))
+		x[v] = make(linalg.Vector, len(v.Vector))
+		for i := range delta[v] {
+			delta[v][i] = rand.NormFloat64() * learnerTestOffset
+			x[v][i] = rand.NormFloat64() * learnerTestOffset
+		}
+	}
+
+	objective := learner.MakeObjective()
+
+	values := [][2]float64{
+		{objective.Objective(delta, weighted), objective.Objective(delta, unweighted)},
+		{objective.Quad(delta, weighted), objective.Quad(delta, unweighted)},
+	}
+	for i, pair := range values {
+		if math.Abs(pair[0]-pair[1]) > learnerTestPrec {
+			t.Errorf("value %d: expected %f but got %f", i, pair[1], pair[0])
+		}
+	}
+
+	grad := objective.QuadGrad(delta, weighted)
+	expGrad := objective.QuadGrad(delta, unweighted)
+	product, value := objective.QuadHessian(delta, x, weighted)
+	expProduct, expValue := objective.QuadHessian(delta, x, unweighted)
+	if math.Abs(value-expValue) > learnerTestPrec {
+		t.Errorf("expected quad value %f but got %f", expValue, value)
+	}
+	for _, pair := range [][2]ConstParamDelta{{grad, expGrad}, {product, expProduct}} {
+		diff := pair[0].Clone()
+		diff.Axpy(-1, pair[1])
+		if diff.Norm() > learnerTestPrec {
+			t.Error("unexpected vector difference", diff.Norm())
+		}
+	}
+}
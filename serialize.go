@@ -0,0 +1,174 @@
+package hessfree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+var deltaMagic = [4]byte{'h', 'f', 'p', 'd'}
+
+// EncodeDelta writes a binary encoding of a delta to w.
+// Variables are identified by their index in the layout,
+// so the encoding can be decoded by any layout with the
+// same parameter order and shapes.
+func (p *ParamLayout) EncodeDelta(w io.Writer, c ConstParamDelta) error {
+	if err := p.validateDelta(c); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(deltaMagic[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint32(len(c))); err != nil {
+		return err
+	}
+	for i, param := range p.params {
+		vec, ok := c[param]
+		if !ok {
+			continue
+		}
+		header := [2]uint32{uint32(i), uint32(len(vec))}
+		if err := binary.Write(bw, binary.LittleEndian, header[:]); err != nil {
+			return err
+		}
+		if err := binary.Write(bw, binary.LittleEndian, []float64(vec)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// DecodeDelta reads a delta which was written by
+// EncodeDelta.
+// It fails if an encoded variable does not exist in the
+// layout or has a different length than the variable.
+func (p *ParamLayout) DecodeDelta(r io.Reader) (ConstParamDelta, error) {
+	br := bufio.NewReader(r)
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != deltaMagic {
+		return nil, errors.New("invalid delta encoding")
+	}
+	var count uint32
+	if err := binary.Read(br, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	res := ConstParamDelta{}
+	for i := uint32(0); i < count; i++ {
+		var header [2]uint32
+		if err := binary.Read(br, binary.LittleEndian, header[:]); err != nil {
+			return nil, err
+		}
+		idx, size := int(header[0]), int(header[1])
+		if idx >= len(p.params) {
+			return nil, fmt.Errorf("variable index %d out of range", idx)
+		}
+		param := p.params[idx]
+		if _, ok := res[param]; ok {
+			return nil, fmt.Errorf("duplicate variable index %d", idx)
+		}
+		if size != len(param.Vector) {
+			return nil, fmt.Errorf("variable %s has length %d but encoding has %d",
+				p.Name(idx), len(param.Vector), size)
+		}
+		vec := make(linalg.Vector, size)
+		if err := binary.Read(br, binary.LittleEndian, []float64(vec)); err != nil {
+			return nil, err
+		}
+		res[param] = vec
+	}
+	return res, nil
+}
+
+// MarshalDelta encodes a delta as a JSON object which maps
+// variable names to their entries.
+// It fails if the delta contains NaN or infinite values,
+// since JSON cannot represent them.
+func (p *ParamLayout) MarshalDelta(c ConstParamDelta) ([]byte, error) {
+	if err := p.validateDelta(c); err != nil {
+		return nil, err
+	}
+	obj := map[string][]float64{}
+	for i, param := range p.params {
+		if vec, ok := c[param]; ok {
+			obj[p.Name(i)] = vec
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// UnmarshalDelta decodes a delta which was encoded with
+// MarshalDelta.
+// It fails if an encoded name does not exist in the
+// layout or has a different length than the variable.
+func (p *ParamLayout) UnmarshalDelta(data []byte) (ConstParamDelta, error) {
+	var obj map[string][]float64
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	nameIndices := map[string]int{}
+	for i := range p.params {
+		nameIndices[p.Name(i)] = i
+	}
+	res := ConstParamDelta{}
+	for name, vec := range obj {
+		idx, ok := nameIndices[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable: %s", name)
+		}
+		param := p.params[idx]
+		if len(vec) != len(param.Vector) {
+			return nil, fmt.Errorf("variable %s has length %d but encoding has %d",
+				name, len(param.Vector), len(vec))
+		}
+		res[param] = vec
+	}
+	return res, nil
+}
+
+// Snapshot returns a copy of the current values of the
+// variables in the layout.
+// Snapshots can be encoded like any other delta.
+func (p *ParamLayout) Snapshot() ConstParamDelta {
+	res := ConstParamDelta{}
+	for _, param := range p.params {
+		res[param] = param.Vector.Copy()
+	}
+	return res
+}
+
+// Restore copies the values from a snapshot into the
+// variables in the layout.
+// Variables which are missing from the snapshot are left
+// unchanged.
+func (p *ParamLayout) Restore(snapshot ConstParamDelta) error {
+	if err := p.validateDelta(snapshot); err != nil {
+		return err
+	}
+	for param, vec := range snapshot {
+		copy(param.Vector, vec)
+	}
+	return nil
+}
+
+func (p *ParamLayout) validateDelta(c ConstParamDelta) error {
+	for param, vec := range c {
+		idx, ok := p.indices[param]
+		if !ok {
+			return errors.New("delta contains variable outside of layout")
+		}
+		if len(vec) != len(param.Vector) {
+			return fmt.Errorf("variable %s has length %d but delta has %d",
+				p.Name(idx), len(param.Vector), len(vec))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package hessfree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/unixpickle/autofunc"
+	"github.com/unixpickle/num-analysis/linalg"
+)
+
+func TestDeltaBinaryEncoding(t *testing.T) {
+	layout, delta := serializeTestDelta()
+
+	var buf bytes.Buffer
+	if err := layout.EncodeDelta(&buf, delta); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := layout.DecodeDelta(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paramDeltaTestEquiv(t, decoded, delta)
+
+	buf.Reset()
+	layout.EncodeDelta(&buf, delta)
+	otherLayout := NewParamLayout([]*autofunc.Variable{
+		{Vector: make(linalg.Vector, 2)},
+		{Vector: make(linalg.Vector, 5)},
+	})
+	if _, err := otherLayout.DecodeDelta(&buf); err == nil {
+		t.Error("expected shape mismatch error")
+	}
+}
+
+func TestDeltaJSONEncoding(t *testing.T) {
+	params := []*autofunc.Variable{
+		{Vector: linalg.Vector{1, 2, 3}},
+		{Vector: linalg.Vector{4, 5}},
+	}
+	layout := NewNamedParamLayout(params, []string{"weights", "biases"})
+	delta := ConstParamDelta{params[1]: linalg.Vector{0.5, -0.25}}
+
+	data, err := layout.MarshalDelta(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"biases":[0.5,-0.25]}` {
+		t.Error("unexpected encoding:", string(data))
+	}
+	decoded, err := layout.UnmarshalDelta(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paramDeltaTestEquiv(t, decoded, delta)
+
+	if _, err := layout.UnmarshalDelta([]byte(`{"biases":[1]}`)); err == nil {
+		t.Error("expected shape mismatch error")
+	}
+	if _, err := layout.UnmarshalDelta([]byte(`{"foo":[1]}`)); err == nil {
+		t.Error("expected unknown variable error")
+	}
+}
+
+func TestParamLayoutSnapshot(t *testing.T) {
+	layout, _ := serializeTestDelta()
+	snapshot := layout.Snapshot()
+	for _, param := range layout.Params() {
+		param.Vector[0] += 1
+	}
+	if err := layout.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	paramDeltaTestEquiv(t, layout.Snapshot(), snapshot)
+}
+
+func serializeTestDelta() (*ParamLayout, ConstParamDelta) {
+	delta, _ := paramDeltaTestDeltas(5)
+	var params []*autofunc.Variable
+	for v := range delta {
+		v.Vector = delta[v].Copy().Scale(2)
+		params = append(params, v)
+	}
+	return NewParamLayout(params), delta
+}
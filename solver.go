@@ -0,0 +1,70 @@
+package hessfree
+
+import "github.com/unixpickle/sgd"
+
+// A Solver approximately minimizes the quadratic
+// approximation of an objective for a mini-batch.
+type Solver interface {
+	// Solve minimizes the quadratic approximation of obj on
+	// the samples.
+	//
+	// The start delta is the QuadMin from the previous
+	// mini-batch, or nil for the first mini-batch.
+	// Solvers may use it as a warm start.
+	//
+	// Solvers should log their progress to t.UI and should
+	// stop early if t.UI.ShouldStop() returns true.
+	Solve(t *Trainer, obj Objective, s sgd.SampleSet, start ConstParamDelta) *SolverResult
+}
+
+// A SolverResult is the outcome of Solver.Solve.
+type SolverResult struct {
+	// Delta is the recommended change to the parameters.
+	Delta ConstParamDelta
+
+	// QuadMin is the solver's estimate of the minimum of
+	// the quadratic approximation.
+	QuadMin ConstParamDelta
+
+	// Value is the true objective value for Delta.
+	Value float64
+
+	// Iterations is the number of iterations the solver
+	// performed.
+	Iterations int
+
+	// Stopped is true if the solver stopped early because
+	// the UI asked it to.
+	// If Stopped is true, the other fields may be unset.
+	Stopped bool
+}
+
+// CGSolver is a Solver which uses Conjugate Gradients with
+// backtracking, as described in Martens (2010).
+// It is configured using the Trainer's Convergence,
+// BacktrackRate, and FlatCG fields.
+type CGSolver struct{}
+
+// Solve runs CG until convergence and returns the best
+// backtracked solution.
+func (_ CGSolver) Solve(t *Trainer, obj Objective, s sgd.SampleSet,
+	start ConstParamDelta) *SolverResult {
+	solver := cgSolver{
+		Trainer:   t,
+		Objective: obj,
+		Samples:   s,
+		Solution:  start,
+	}
+	for solver.Step() {
+		if t.UI.ShouldStop() {
+			return &SolverResult{Stopped: true}
+		}
+	}
+	delta, value := solver.Best()
+	return &SolverResult{
+		Delta:      delta,
+		QuadMin:    solver.Solution,
+		Value:      value,
+		Iterations: len(solver.quadValues),
+	}
+}
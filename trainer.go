@@ -1,7 +1,9 @@
 package hessfree
 
 import (
+	"fmt"
 	"math"
+	"time"
 
 	"github.com/unixpickle/num-analysis/linalg"
 	"github.com/unixpickle/sgd"
@@ -48,9 +50,30 @@ type Trainer struct {
 	// how frequently backtracking checkpoints are made.
 	// If this is 0, the default from Martens (2010) is used.
 	BacktrackRate float64
+
+	// Validation, if non-nil, is a set of samples whose
+	// cost is computed and logged after every epoch.
+	// The cost is the learner's true objective, so it is a
+	// sum over samples unless the learner's objectives are
+	// normalized.
+	// If the Learner is an Evaluator, the cost is computed
+	// with Evaluate.
+	Validation sgd.SampleSet
+
+	// FlatCG specifies that Conjugate Gradients should store
+	// its vectors contiguously, as FlatParamDeltas, so that
+	// vector arithmetic does not iterate over maps.
+	FlatCG bool
+
+	// Solver minimizes the quadratic approximation for each
+	// mini-batch.
+	// If this is nil, CGSolver is used.
+	Solver Solver
 }
 
 func (t *Trainer) Train() {
+	events, _ := t.UI.(EventUI)
+
 	var epoch int
 	var lastSolution ConstParamDelta
 	for {
@@ -68,38 +91,77 @@ func (t *Trainer) Train() {
 				return
 			}
 			t.UI.LogNewMiniBatch(epoch, miniBatch)
+			batchStart := time.Now()
 
-			solver := cgSolver{
-				Trainer:   t,
-				Objective: t.Learner.MakeObjective(),
-				Samples:   subset,
-				Solution:  lastSolution,
+			result := t.solver().Solve(t, t.Learner.MakeObjective(), subset,
+				lastSolution)
+			if result.Stopped {
+				return
 			}
-			for solver.Step() {
-				if t.UI.ShouldStop() {
-					return
-				}
+			lastSolution = result.QuadMin
+			if events != nil {
+				events.LogTiming(TimingCG, time.Since(batchStart))
+				events.LogUpdate(result.Iterations, result.Value)
+			}
+
+			adjustStart := time.Now()
+			t.Learner.Adjust(result.Delta, lastSolution, subset)
+			if events != nil {
+				events.LogTiming(TimingAdjust, time.Since(adjustStart))
+				events.LogTiming(TimingMiniBatch, time.Since(batchStart))
 			}
-			useDelta := solver.Best()
-			lastSolution = solver.Solution
-			t.Learner.Adjust(useDelta, lastSolution, subset)
 
 			miniBatch++
 		}
+
+		if events != nil {
+			events.LogEpochEnd(epoch)
+		}
+		if t.Validation != nil {
+			logValidation(t.Learner, t.UI, t.Validation, epoch)
+		}
+
 		epoch++
 	}
 }
 
+func (t *Trainer) solver() Solver {
+	if t.Solver == nil {
+		return CGSolver{}
+	}
+	return t.Solver
+}
+
+// logValidation computes the cost of a learner on a
+// validation set and logs it to the UI.
+// If the learner is not an Evaluator, this creates an
+// Objective outside of the MakeObjective and Adjust cycle.
+func logValidation(l Learner, ui UI, validation sgd.SampleSet, epoch int) {
+	logValidationCost(ui, epoch, evaluate(l, validation))
+}
+
+// logValidationCost logs a validation cost to the UI,
+// using a Log message if the UI is not an EventUI.
+func logValidationCost(ui UI, epoch int, cost float64) {
+	if events, ok := ui.(EventUI); ok {
+		events.LogValidation(epoch, cost)
+	} else {
+		ui.Log("Trainer", fmt.Sprintf("validation cost is %f", cost))
+	}
+}
+
 type cgSolver struct {
 	Trainer   *Trainer
 	Objective Objective
 	Samples   sgd.SampleSet
 	Solution  ConstParamDelta
 
-	residual          ConstParamDelta
-	projectedResidual ConstParamDelta
+	layout            *ParamLayout
+	solution          *cgVector
+	residual          *cgVector
+	projectedResidual *cgVector
 	residualMag2      float64
-	hessianProduct    ConstParamDelta
+	hessianProduct    *cgVector
 	lastQuadValue     float64
 
 	justBacktracked bool
@@ -116,7 +178,7 @@ type cgSolver struct {
 func (c *cgSolver) Step() (shouldContinue bool) {
 	c.initializeIfNeeded()
 
-	projHessianMag := c.projectedResidual.dot(c.hessianProduct)
+	projHessianMag := c.projectedResidual.Dot(c.hessianProduct)
 	if projHessianMag == 0 || c.residualMag2 == 0 {
 		return false
 	}
@@ -124,19 +186,18 @@ func (c *cgSolver) Step() (shouldContinue bool) {
 	c.justBacktracked = false
 	stepSize := c.residualMag2 / projHessianMag
 
-	c.Solution.addDelta(c.projectedResidual, stepSize)
+	c.solution.Axpy(stepSize, c.projectedResidual)
 
 	oldRMag2 := c.residualMag2
-	c.residual.addDelta(c.hessianProduct, -stepSize)
-	c.residualMag2 = c.residual.magSquared()
+	c.residual.Axpy(-stepSize, c.hessianProduct)
+	c.residualMag2 = c.residual.Dot(c.residual)
 
 	beta := c.residualMag2 / oldRMag2
-	c.projectedResidual.scale(beta)
-	c.projectedResidual.addDelta(c.residual, 1)
+	c.projectedResidual.Scale(beta)
+	c.projectedResidual.Axpy(1, c.residual)
 
-	var quadValue float64
-	c.hessianProduct, quadValue = c.Objective.QuadHessian(c.projectedResidual,
-		c.Solution, c.Samples)
+	product, quadValue := c.quadHessian()
+	c.hessianProduct.Set(product)
 	c.quadValues = append(c.quadValues, quadValue)
 
 	c.Trainer.UI.LogCGIteration(stepSize, quadValue)
@@ -151,13 +212,11 @@ func (c *cgSolver) Step() (shouldContinue bool) {
 }
 
 // Best returns the best known solution, including the
-// current solution and all the backtracked ones.
-func (c *cgSolver) Best() ConstParamDelta {
+// current solution and all the backtracked ones, along
+// with its objective value.
+func (c *cgSolver) Best() (ConstParamDelta, float64) {
 	if !c.justBacktracked {
-		btValue := c.Objective.Objective(c.Solution, c.Samples)
-		c.backtrackDeltas = append(c.backtrackDeltas, c.Solution)
-		c.backtrackValues = append(c.backtrackValues, btValue)
-		c.justBacktracked = true
+		c.checkpoint(c.Solution)
 	}
 	var bestVal float64
 	var bestDelta ConstParamDelta
@@ -167,23 +226,29 @@ func (c *cgSolver) Best() ConstParamDelta {
 			bestVal = v
 		}
 	}
-	return bestDelta
+	return bestDelta, bestVal
 }
 
 func (c *cgSolver) initializeIfNeeded() {
-	if c.Solution == nil {
-		c.Solution = c.zeroDelta()
+	if c.solution == nil {
+		if c.Trainer.FlatCG {
+			c.layout = NewParamLayout(c.Trainer.Learner.Parameters())
+		}
+		if c.Solution == nil {
+			c.Solution = c.zeroDelta()
+		}
+		c.solution = c.newVector(c.Solution)
+		c.Solution = c.solution.Delta
 	}
 	if c.residual == nil {
-		c.residual = c.Objective.QuadGrad(c.Solution, c.Samples)
-		c.residual.scale(-1)
-		c.projectedResidual = c.residual.copy()
-		c.residualMag2 = c.residual.magSquared()
+		c.residual = c.newVector(c.Objective.QuadGrad(c.Solution, c.Samples))
+		c.residual.Scale(-1)
+		c.projectedResidual = c.residual.Clone()
+		c.residualMag2 = c.residual.Dot(c.residual)
 		c.startObjective = c.Objective.Objective(ConstParamDelta{}, c.Samples)
 
-		var quadValue float64
-		c.hessianProduct, quadValue = c.Objective.QuadHessian(c.projectedResidual,
-			c.Solution, c.Samples)
+		product, quadValue := c.quadHessian()
+		c.hessianProduct = c.newVector(product)
 		c.Trainer.UI.LogCGStart(quadValue, c.startObjective)
 	}
 }
@@ -230,10 +295,42 @@ func (c *cgSolver) updateBacktracking() {
 		c.backtrackCount++
 	}
 
-	btValue := c.Objective.Objective(c.Solution, c.Samples)
-	c.backtrackDeltas = append(c.backtrackDeltas, c.Solution.copy())
+	c.checkpoint(c.Solution.Clone())
+}
+
+// quadHessian applies the Hessian to the projected
+// residual while evaluating the quadratic at the current
+// solution, reporting the time it took to an EventUI.
+func (c *cgSolver) quadHessian() (ConstParamDelta, float64) {
+	start := time.Now()
+	product, quadValue := c.Objective.QuadHessian(c.projectedResidual.Delta,
+		c.Solution, c.Samples)
+	if events, ok := c.Trainer.UI.(EventUI); ok {
+		events.LogTiming(TimingQuadHessian, time.Since(start))
+	}
+	return product, quadValue
+}
+
+// checkpoint records a backtracking checkpoint.
+func (c *cgSolver) checkpoint(delta ConstParamDelta) {
+	btValue := c.Objective.Objective(delta, c.Samples)
+	c.backtrackDeltas = append(c.backtrackDeltas, delta)
 	c.backtrackValues = append(c.backtrackValues, btValue)
 	c.justBacktracked = true
+	if events, ok := c.Trainer.UI.(EventUI); ok {
+		events.LogBacktrack(len(c.quadValues), btValue)
+	}
+}
+
+// newVector creates a cgVector for the given delta.
+// If the solver is not flat, the vector takes ownership
+// of the delta.
+func (c *cgSolver) newVector(d ConstParamDelta) *cgVector {
+	if c.layout == nil {
+		return &cgVector{Delta: d}
+	}
+	flat := FlattenDelta(c.layout, d)
+	return &cgVector{Delta: flat.Delta(), Flat: flat}
 }
 
 func (c *cgSolver) zeroDelta() ConstParamDelta {
@@ -243,3 +340,51 @@ func (c *cgSolver) zeroDelta() ConstParamDelta {
 	}
 	return delta
 }
+
+// A cgVector is a vector used by cgSolver, optionally
+// backed by a FlatParamDelta.
+type cgVector struct {
+	Delta ConstParamDelta
+	Flat  *FlatParamDelta
+}
+
+func (c *cgVector) Dot(c1 *cgVector) float64 {
+	if c.Flat != nil {
+		return c.Flat.Dot(c1.Flat)
+	}
+	return c.Delta.Dot(c1.Delta)
+}
+
+func (c *cgVector) Axpy(scaler float64, c1 *cgVector) {
+	if c.Flat != nil {
+		c.Flat.Axpy(scaler, c1.Flat)
+	} else {
+		c.Delta.Axpy(scaler, c1.Delta)
+	}
+}
+
+func (c *cgVector) Scale(scaler float64) {
+	if c.Flat != nil {
+		c.Flat.Scale(scaler)
+	} else {
+		c.Delta.Scale(scaler)
+	}
+}
+
+func (c *cgVector) Clone() *cgVector {
+	if c.Flat != nil {
+		flat := c.Flat.Clone()
+		return &cgVector{Delta: flat.Delta(), Flat: flat}
+	}
+	return &cgVector{Delta: c.Delta.Clone()}
+}
+
+// Set replaces the vector's contents with d.
+// If the vector is not flat, it takes ownership of d.
+func (c *cgVector) Set(d ConstParamDelta) {
+	if c.Flat != nil {
+		c.Flat.SetDelta(d)
+	} else {
+		c.Delta = d
+	}
+}
@@ -0,0 +1,142 @@
+package hessfree
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/unixpickle/num-analysis/linalg"
+	"github.com/unixpickle/sgd"
+	"github.com/unixpickle/weakai/neuralnet"
+)
+
+func TestTrainerEvents(t *testing.T) {
+	learner, samples := trainerTestLearner()
+	ui := &recordingUI{stopEpoch: 2}
+	trainer := &Trainer{
+		Learner:    learner,
+		Samples:    samples,
+		BatchSize:  10,
+		UI:         ui,
+		Validation: samples.Subset(0, 5),
+	}
+	learner.UI = ui
+	trainer.Train()
+
+	if ui.updates != 4 {
+		t.Error("expected 4 updates but got", ui.updates)
+	}
+	if ui.validations != 2 {
+		t.Error("expected 2 validations but got", ui.validations)
+	}
+	if ui.dampings != 4 || ui.ratios != 4 {
+		t.Error("expected 4 damping events but got", ui.dampings, ui.ratios)
+	}
+	if ui.backtracks < ui.updates {
+		t.Error("expected at least one backtrack per update")
+	}
+	for _, name := range []string{TimingCG, TimingAdjust, TimingMiniBatch} {
+		if ui.timings[name] != 4 {
+			t.Error("expected 4 timings for", name, "but got", ui.timings[name])
+		}
+	}
+}
+
+func trainerTestLearner() (*DampingLearner, sgd.SampleSet) {
+	network := neuralnet.Network{
+		&neuralnet.DenseLayer{
+			InputCount:  5,
+			OutputCount: 4,
+		},
+		neuralnet.Sigmoid{},
+		&neuralnet.DenseLayer{
+			InputCount:  4,
+			OutputCount: 5,
+		},
+	}
+	network.Randomize()
+
+	learner := &DampingLearner{
+		WrappedLearner: &NeuralNetLearner{
+			Layers:         network,
+			Output:         nil,
+			Cost:           neuralnet.SigmoidCECost{},
+			MaxSubBatch:    10,
+			MaxConcurrency: 1,
+		},
+	}
+
+	var inputs []linalg.Vector
+	for i := 0; i < 20; i++ {
+		vec := make(linalg.Vector, 5)
+		for i := range vec {
+			vec[i] = rand.Float64()
+		}
+		inputs = append(inputs, vec)
+	}
+	return learner, neuralnet.VectorSampleSet(inputs, inputs)
+}
+
+type recordingUI struct {
+	nopUI
+
+	stopEpoch int
+	epochs    int
+
+	solves       int
+	cgIterations int
+
+	backtracks    int
+	updates       int
+	maxIterations int
+	dampings      int
+	ratios        int
+	validations   int
+	timings       map[string]int
+}
+
+func (r *recordingUI) ShouldStop() bool {
+	return r.epochs >= r.stopEpoch
+}
+
+func (r *recordingUI) LogCGStart(initQuad, quadLast float64) {
+	r.solves++
+}
+
+func (r *recordingUI) LogCGIteration(stepSize, quadValue float64) {
+	r.cgIterations++
+}
+
+func (r *recordingUI) LogDamping(trust, coeff float64) {
+	r.dampings++
+}
+
+func (r *recordingUI) LogBacktrack(iteration int, objective float64) {
+	r.backtracks++
+}
+
+func (r *recordingUI) LogUpdate(iterations int, objective float64) {
+	r.updates++
+	if iterations > r.maxIterations {
+		r.maxIterations = iterations
+	}
+}
+
+func (r *recordingUI) LogReductionRatio(ratio float64) {
+	r.ratios++
+}
+
+func (r *recordingUI) LogEpochEnd(epoch int) {
+	r.epochs++
+}
+
+func (r *recordingUI) LogValidation(epoch int, cost float64) {
+	r.validations++
+}
+
+func (r *recordingUI) LogTiming(name string, duration time.Duration) {
+	if r.timings == nil {
+		r.timings = map[string]int{}
+	}
+	r.timings[name]++
+}
@@ -5,7 +5,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // A UI logs information about a Hessian Free training
@@ -18,29 +20,181 @@ type UI interface {
 	ShouldStop() bool
 }
 
+// A DampingLogger is a UI which can record damping
+// updates in a structured form.
+// DampingLearner uses this interface when its UI
+// implements it.
+type DampingLogger interface {
+	// LogDamping records the trust quotient for the last
+	// update and the damping coefficient which resulted.
+	LogDamping(trust, coeff float64)
+}
+
+// Names of the timings reported to EventUIs.
+const (
+	TimingCG          = "cg"
+	TimingQuadHessian = "quad_hessian"
+	TimingAdjust      = "adjust"
+	TimingMiniBatch   = "mini_batch"
+	TimingLineSearch  = "line_search"
+)
+
+// An EventUI is a UI which receives typed events in
+// addition to the basic UI callbacks.
+// Trainers and learners check if their UI implements
+// EventUI and only report these events if it does.
+type EventUI interface {
+	UI
+	DampingLogger
+
+	// LogBacktrack records a backtracking checkpoint, giving
+	// the number of CG iterations completed so far and the
+	// true objective value at the checkpoint.
+	LogBacktrack(iteration int, objective float64)
+
+	// LogUpdate records the update chosen after CG, giving
+	// the number of CG iterations and the true objective
+	// value for the chosen update.
+	LogUpdate(iterations int, objective float64)
+
+	// LogReductionRatio records the ratio between the actual
+	// reduction in the objective and the reduction predicted
+	// by the quadratic approximation.
+	LogReductionRatio(ratio float64)
+
+	// LogEpochEnd records the end of an epoch.
+	LogEpochEnd(epoch int)
+
+	// LogValidation records the cost on a validation set
+	// after the given epoch.
+	// Like other objective values, the cost is a sum over
+	// samples unless the objectives are normalized.
+	LogValidation(epoch int, cost float64)
+
+	// LogTiming records how long some stage of training
+	// took, identified by a name like TimingCG.
+	LogTiming(name string, duration time.Duration)
+}
+
 // ConsoleUI is a UI which outputs things to the console
 // using the log package and stops when the user sends a
 // kill interrupt.
+//
+// The first signal asks training to stop gracefully.
+// A second signal runs the terminate hook, if there is
+// one, and then exits the process.
+// If the hook blocks, a third signal exits the process
+// without waiting for it.
 type ConsoleUI struct {
 	killFlag uint32
+
+	lock          sync.Mutex
+	terminateHook func()
+
+	signals   chan os.Signal
+	closed    chan struct{}
+	closeOnce sync.Once
+	exit      func(code int)
 }
 
+// NewConsoleUI creates a ConsoleUI which listens for
+// interrupt signals.
 func NewConsoleUI() *ConsoleUI {
-	res := &ConsoleUI{}
-
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		<-c
-		signal.Stop(c)
-		close(c)
-		atomic.StoreUint32(&res.killFlag, 1)
-		fmt.Println("\nCaught interrupt. Ctrl+C again to terminate.")
-	}()
+	return NewConsoleUISignals()
+}
 
+// NewConsoleUISignals creates a ConsoleUI which listens
+// for the given signals instead of just interrupts.
+// For example, SIGTERM can be used to stop gracefully
+// under a job scheduler.
+// If no signals are given, interrupts are used.
+func NewConsoleUISignals(sigs ...os.Signal) *ConsoleUI {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt}
+	}
+	res := &ConsoleUI{
+		signals: make(chan os.Signal, 1),
+		closed:  make(chan struct{}),
+		exit:    os.Exit,
+	}
+	signal.Notify(res.signals, sigs...)
+	go res.handleSignals()
 	return res
 }
 
+// SetTerminateHook sets a function which is called after a
+// second signal, right before the process exits.
+// This can be used to save a final checkpoint.
+func (c *ConsoleUI) SetTerminateHook(f func()) {
+	c.lock.Lock()
+	c.terminateHook = f
+	c.lock.Unlock()
+}
+
+// Stop makes ShouldStop return true, as if a signal had
+// been received.
+func (c *ConsoleUI) Stop() {
+	atomic.StoreUint32(&c.killFlag, 1)
+}
+
+// Close stops listening for signals.
+// Signals received after Close are handled by the default
+// handlers again.
+// Close does nothing for a ConsoleUI which was not created
+// with NewConsoleUI or NewConsoleUISignals, since such a
+// ConsoleUI does not listen for signals.
+func (c *ConsoleUI) Close() {
+	c.closeOnce.Do(func() {
+		if c.closed != nil {
+			signal.Stop(c.signals)
+			close(c.closed)
+		}
+	})
+}
+
+func (c *ConsoleUI) handleSignals() {
+	var caught bool
+
+	// hookDone is closed once the terminate hook returns.
+	// It is nil until the hook is started.
+	var hookDone chan struct{}
+
+	for {
+		select {
+		case sig := <-c.signals:
+			if !caught {
+				caught = true
+				c.Stop()
+				if sig == os.Interrupt {
+					fmt.Println("\nCaught interrupt. Ctrl+C again to terminate.")
+				} else {
+					fmt.Printf("\nCaught %v. Send again to terminate.\n", sig)
+				}
+				continue
+			}
+			if hookDone != nil {
+				c.exit(1)
+				return
+			}
+			c.lock.Lock()
+			hook := c.terminateHook
+			c.lock.Unlock()
+			hookDone = make(chan struct{})
+			go func() {
+				if hook != nil {
+					hook()
+				}
+				close(hookDone)
+			}()
+		case <-hookDone:
+			c.exit(1)
+			return
+		case <-c.closed:
+			return
+		}
+	}
+}
+
 func (c *ConsoleUI) LogCGStart(initQuad, quadLast float64) {
 	log.Printf("Starting CG (quad=%f, baseline=%f)", initQuad, quadLast)
 }
@@ -0,0 +1,97 @@
+package hessfree
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConsoleUISignals(t *testing.T) {
+	ui := NewConsoleUISignals()
+	defer ui.Close()
+
+	hookCalled := make(chan struct{})
+	exitCodes := make(chan int, 1)
+	ui.exit = func(code int) {
+		exitCodes <- code
+	}
+	ui.SetTerminateHook(func() {
+		close(hookCalled)
+	})
+
+	ui.signals <- os.Interrupt
+	waitForStop(t, ui)
+
+	ui.signals <- os.Interrupt
+	select {
+	case <-hookCalled:
+	case <-time.After(time.Second):
+		t.Fatal("terminate hook was not called")
+	}
+	if code := <-exitCodes; code != 1 {
+		t.Error("unexpected exit code", code)
+	}
+}
+
+func TestConsoleUIStop(t *testing.T) {
+	ui := NewConsoleUISignals()
+	if ui.ShouldStop() {
+		t.Fatal("should not stop yet")
+	}
+	ui.Stop()
+	if !ui.ShouldStop() {
+		t.Error("should stop after Stop()")
+	}
+	ui.Close()
+	ui.Close()
+}
+
+func TestConsoleUIZeroValue(t *testing.T) {
+	var ui ConsoleUI
+	ui.Stop()
+	if !ui.ShouldStop() {
+		t.Error("should stop after Stop()")
+	}
+	ui.Close()
+}
+
+func waitForStop(t *testing.T, ui UI) {
+	timeout := time.After(time.Second)
+	for !ui.ShouldStop() {
+		select {
+		case <-timeout:
+			t.Fatal("UI did not stop")
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestConsoleUIBlockingHook(t *testing.T) {
+	ui := NewConsoleUISignals()
+	defer ui.Close()
+
+	exitCodes := make(chan int, 1)
+	ui.exit = func(code int) {
+		exitCodes <- code
+	}
+	blockHook := make(chan struct{})
+	defer close(blockHook)
+	ui.SetTerminateHook(func() {
+		<-blockHook
+	})
+
+	ui.signals <- os.Interrupt
+	waitForStop(t, ui)
+	ui.signals <- os.Interrupt
+	ui.signals <- os.Interrupt
+
+	select {
+	case code := <-exitCodes:
+		if code != 1 {
+			t.Error("unexpected exit code", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("third signal did not exit")
+	}
+}